@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	internalconfig "github.com/spendmail/previewer/internal/config"
+)
+
+var ErrConfigCommand = errors.New("unknown config command")
+
+// configCommand runs "config" subcommands: "print" shows the effective configuration, i.e. the file
+// merged with built-in defaults, environment variables and flags, "validate" checks it, listing every problem.
+func configCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected \"print\" or \"validate\"", ErrConfigCommand)
+	}
+
+	flags := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to configuration file")
+	internalconfig.BindFlags(flags)
+
+	// Errors are handled by the flag set itself.
+	_ = flags.Parse(args[1:])
+
+	switch args[0] {
+	case "print":
+		return internalconfig.Print(os.Stdout, configFile(), flags)
+	case "validate":
+		return validateConfig(flags)
+	default:
+		return fmt.Errorf("%w: %s", ErrConfigCommand, args[0])
+	}
+}
+
+// validateConfig prints problems of the configuration one per line, failing if there are any.
+func validateConfig(flags *flag.FlagSet) error {
+	_, err := internalconfig.Load(configFile(), flags)
+
+	var invalid *internalconfig.ValidationError
+	if errors.As(err, &invalid) {
+		for _, problem := range invalid.Problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+
+		return fmt.Errorf("%w: %d problems found", internalconfig.ErrConfigInvalid, len(invalid.Problems))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("configuration is valid")
+
+	return nil
+}
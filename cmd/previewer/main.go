@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
+	"os"
 	"os/signal"
 	"sync"
 	"syscall"
@@ -13,14 +15,20 @@ import (
 	internalcache "github.com/spendmail/previewer/internal/cache"
 	internalconfig "github.com/spendmail/previewer/internal/config"
 	internallogger "github.com/spendmail/previewer/internal/logger"
+	internalmetrics "github.com/spendmail/previewer/internal/metrics"
 	internalresizer "github.com/spendmail/previewer/internal/resizer"
 	internalserver "github.com/spendmail/previewer/internal/server/http"
+	internaltracing "github.com/spendmail/previewer/internal/tracing"
 )
 
+// DefaultConfigPath is the path of the configuration file, which is optional: built-in defaults are used without it.
+const DefaultConfigPath = "/etc/previewer/previewer.toml"
+
 var configPath string
 
 func init() {
-	flag.StringVar(&configPath, "config", "/etc/previewer/previewer.toml", "Path to configuration file")
+	flag.StringVar(&configPath, "config", DefaultConfigPath, "Path to configuration file")
+	internalconfig.BindFlags(flag.CommandLine)
 }
 
 func main() {
@@ -31,8 +39,22 @@ func main() {
 		return
 	}
 
+	if flag.Arg(0) == "config" {
+		if err := configCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "warmup" {
+		if err := warmup(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Config initialization.
-	config, err := internalconfig.NewConfig(configPath)
+	config, err := internalconfig.Load(configFile(), flag.CommandLine)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -43,29 +65,71 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Tracing initialization, spans are exported unless the exporter is "none".
+	tracing, err := internaltracing.New(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Cache initialization.
 	cache, err := internalcache.New(config, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Metrics initialization, cache counters are exposed by backends, which keep them.
+	metrics := internalmetrics.New()
+	if source, ok := cache.(internalmetrics.StatsSource); ok {
+		metrics.RegisterCache(source)
+	}
+
 	// Application initialization.
-	app, err := internalapp.New(logger, internalresizer.New(), cache)
+	app, err := internalapp.New(config, logger, internalresizer.New(), cache, metrics)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// HTTP server initialization.
-	server := internalserver.New(config, logger, app)
+	server := internalserver.New(config, logger, app, metrics)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGHUP)
+	// Admin HTTP server initialization, it stays disabled until a token is configured.
+	var admin *internalserver.Server
+	if config.GetAdminToken() != "" {
+		admin = internalserver.NewAdmin(config, logger, app)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
 	var wg sync.WaitGroup
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// Reopening the log file on SIGHUP, so that it can be rotated by logrotate.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := logger.Reopen(); err != nil {
+					log.Println(err)
+					continue
+				}
+
+				logger.Info("log file reopened")
+			}
+		}
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -73,14 +137,53 @@ func main() {
 		// Locking until OS signal is sent or context cancel func is called.
 		<-ctx.Done()
 
+		// Failing readiness checks first, so that load balancers stop sending requests.
+		server.Drain()
+		logger.Info("draining http server...")
+		time.Sleep(config.GetHealthDrainDelay())
+
 		// Stopping http server.
 		stopHTTPCtx, stopHTTPCancel := context.WithTimeout(context.Background(), time.Second*3)
 		defer stopHTTPCancel()
 		if err := server.Stop(stopHTTPCtx); err != nil {
 			logger.Error(err.Error())
 		}
+
+		if admin != nil {
+			if err := admin.Stop(stopHTTPCtx); err != nil {
+				logger.Error(err.Error())
+			}
+		}
+
+		// Flushing pending spans.
+		if err := tracing.Shutdown(stopHTTPCtx); err != nil {
+			logger.Error(err.Error())
+		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// Removing expired cache items until OS signal is sent or context cancel func is called.
+		internalcache.NewJanitor(config, logger, cache).Run(ctx)
+	}()
+
+	if admin != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			logger.Info("starting admin http server...")
+
+			// Locking over here until server is stopped.
+			if err := admin.Start(); err != nil {
+				logger.Error(err.Error())
+				cancel()
+			}
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -95,4 +198,19 @@ func main() {
 	}()
 
 	wg.Wait()
+
+	if err := logger.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// configFile returns the path of the configuration file, empty if the default one doesn't exist.
+func configFile() string {
+	if configPath == DefaultConfigPath {
+		if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+			return ""
+		}
+	}
+
+	return configPath
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	internalserver "github.com/spendmail/previewer/internal/server/http"
+)
+
+var ErrWarmupFailed = errors.New("warmup failed")
+
+// warmup makes the running server render items listed in the input file into its cache, by calling
+// its cache management API. The server renders them, so that its cache, whatever the backend is,
+// knows about them, and none of its files are touched by another process.
+func warmup(args []string) error {
+	flags := flag.NewFlagSet("warmup", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "Path to configuration file")
+	input := flags.String("input", "", "Path to file with items to render, one per line, e.g. /fill/300/200/example.com/image.jpg")
+	concurrency := flags.Int("concurrency", internalapp.DefaultWarmupConcurrency, "Count of items rendered at once")
+	internalconfig.BindFlags(flags)
+
+	// Errors are handled by the flag set itself.
+	_ = flags.Parse(args)
+
+	items, err := readWarmupItems(*input)
+	if err != nil {
+		return err
+	}
+
+	config, err := internalconfig.Load(configFile(), flags)
+	if err != nil {
+		return err
+	}
+
+	if config.GetAdminToken() == "" {
+		return fmt.Errorf("%w: admin.token is required to call the server", ErrWarmupFailed)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	results, err := internalserver.NewAdminClient(config).Warmup(ctx, items, *concurrency)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWarmupFailed, err)
+	}
+
+	failed := 0
+	for _, result := range results {
+		item := result.Item
+		if result.Err != nil {
+			failed++
+			fmt.Printf("error\t/%s/%d/%d/%s\t%s\n", internalapp.ModeFill, item.Width, item.Height, item.URL, result.Err)
+
+			continue
+		}
+
+		fmt.Printf("ok\t/%s/%d/%d/%s\t%d bytes\n", internalapp.ModeFill, item.Width, item.Height, item.URL, result.Bytes)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d items", ErrWarmupFailed, failed, len(items))
+	}
+
+	return nil
+}
+
+// readWarmupItems reads items from the file, skipping empty lines and comments starting with "#".
+func readWarmupItems(path string) ([]internalapp.WarmupItem, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: input file is required", ErrWarmupFailed)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	items := make([]internalapp.WarmupItem, 0)
+	scanner := bufio.NewScanner(file)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		item, err := internalapp.ParseWarmupItem(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrWarmupFailed, n, err)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
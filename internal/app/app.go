@@ -1,23 +1,61 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	imagepkg "image"
+	_ "image/gif"  // Registers GIF to read dimensions of images.
+	_ "image/jpeg" // Registers JPEG to read dimensions of images.
+	_ "image/png"  // Registers PNG to read dimensions of images.
 	"io"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	internalcache "github.com/spendmail/previewer/internal/cache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	DefaultScheme = "http://"
+	ModeFill      = "fill"
+
+	CacheHit          = "hit"
+	CacheStale        = "stale"
+	CacheMiss         = "miss"
+	CacheStaleIfError = "stale-if-error"
 )
 
+// tracer follows the globally installed tracer provider.
+var tracer = otel.Tracer("github.com/spendmail/previewer/internal/app")
+
+type Config interface {
+	GetOriginTimeout() time.Duration
+	GetOriginMaxSize() int64
+	GetCacheTTL() time.Duration
+	GetCacheOriginTTL() bool
+	GetCacheStaleWhileRevalidate() time.Duration
+	GetCacheMaxStale() time.Duration
+	GetHealthCanaryURL() string
+	GetHealthTimeout() time.Duration
+}
+
 type Logger interface {
 	Debug(args ...interface{})
 	Info(args ...interface{})
 	Warn(args ...interface{})
 	Error(args ...interface{})
+	WarnContext(ctx context.Context, args ...interface{})
 }
 
 type Resizer interface {
@@ -25,15 +63,83 @@ type Resizer interface {
 }
 
 type Cache interface {
-	Set(key string, value []byte) error
-	Get(key string) ([]byte, error)
+	Set(key string, item *internalcache.Item) error
+	Get(key string) (*internalcache.Item, error)
 	Clear()
 }
 
+type Metrics interface {
+	DownloadStarted() func(size int, err error)
+	ResizeStarted(format, mode string) func()
+}
+
 type Application struct {
+	Config  Config
 	Logger  Logger
 	Resizer Resizer
 	Cache   Cache
+	Metrics Metrics
+	Client  *http.Client
+	// refreshing holds keys of items being refreshed in background.
+	refreshing sync.Map
+}
+
+// Result is a processed image along with its metadata.
+type Result struct {
+	// Body reads the image, which may be streamed from cache, so the result must be closed once read.
+	Body        io.ReadSeeker
+	Size        int64
+	ContentType string
+	// Width and Height are actual dimensions of the processed image, which may differ from requested ones.
+	Width        int
+	Height       int
+	ETag         string
+	LastModified time.Time
+	CachePolicy  CachePolicy
+	// CacheStatus tells how the image was served: one of CacheHit, CacheStale, CacheMiss or CacheStaleIfError.
+	CacheStatus string
+	// OriginStatus is the status code of the origin response, zero if the origin wasn't requested.
+	OriginStatus int
+	Timings      Timings
+	// SourceWidth and SourceHeight are dimensions of the source image, zero unless it was downloaded
+	// and its format is known.
+	SourceWidth  int
+	SourceHeight int
+}
+
+// CachePolicy tells how long the image may be cached.
+type CachePolicy struct {
+	// FreshUntil is zero if the image never goes stale.
+	FreshUntil time.Time
+	// NoStore is set if the origin forbids caching the image.
+	NoStore bool
+}
+
+// Timings are durations of serving phases, zero if a phase didn't happen.
+type Timings struct {
+	// Cache is the time spent reading and writing the cache.
+	Cache  time.Duration
+	Fetch  time.Duration
+	Resize time.Duration
+}
+
+// content is a readable image along with its size and type.
+type content struct {
+	body        io.ReadSeeker
+	size        int64
+	contentType string
+	width       int
+	height      int
+}
+
+// rendering is an outcome of rendering an image: the origin status and timings are known even if it fails.
+type rendering struct {
+	item         *internalcache.Item
+	noStore      bool
+	originStatus int
+	timings      Timings
+	sourceWidth  int
+	sourceHeight int
 }
 
 var (
@@ -42,52 +148,552 @@ var (
 	ErrServerNotExists = errors.New("remove server doesn't exist")
 	ErrRequest         = errors.New("request error")
 	ErrFileRead        = errors.New("unable to read a file")
+	ErrCacheAdmin      = errors.New("cache backend doesn't support management")
+	ErrFileTooLarge    = errors.New("file is too large")
+	ErrOriginStatus    = errors.New("unexpected origin response status")
 )
 
+// clientOnlyHeaders refer to responses of the service, e.g. ranges of the rendered image, so they are
+// not forwarded to the origin, which must respond with the whole source image.
+var clientOnlyHeaders = []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
 // New is an application constructor.
-func New(logger Logger, resizer Resizer, cache Cache) (*Application, error) {
+func New(config Config, logger Logger, resizer Resizer, cache Cache, metrics Metrics) (*Application, error) {
 	return &Application{
+		Config:  config,
 		Cache:   cache,
 		Logger:  logger,
 		Resizer: resizer,
+		Metrics: metrics,
+		Client:  &http.Client{Timeout: config.GetOriginTimeout()},
 	}, nil
 }
 
 // ResizeImageByURL downloads, caches and crops images by given sizes and URL.
-func (app *Application) ResizeImageByURL(width, height int, url string, headers map[string][]string) ([]byte, error) {
-	// Key includes sizes in order to store different files for different sizes of the same file.
-	cacheKey := fmt.Sprintf("%s-%d-%d", url, width, height)
+func (app *Application) ResizeImageByURL(ctx context.Context, width, height int, url string, headers map[string][]string) (*Result, error) {
+	ctx, span := tracer.Start(ctx, "app.ResizeImageByURL", trace.WithAttributes(
+		attribute.String("image.url", url),
+		attribute.Int("image.width", width),
+		attribute.Int("image.height", height),
+	))
+	defer span.End()
+
+	// Key includes every transformation option in order to store different files for different variants of the same file.
+	cacheKey := internalcache.TransformKey{Source: url, Mode: ModeFill, Width: width, Height: height}.String()
+
+	// If fresh file exists in cache, return from there.
+	start := time.Now()
+	item, cached, err := app.cacheGet(ctx, cacheKey)
+	cacheTime := time.Since(start)
 
-	// If file exists in cache, return from there.
-	resultBytes, err := app.Cache.Get(cacheKey)
 	if err == nil {
-		return resultBytes, nil
+		now := time.Now()
+		if item.Fresh(now) {
+			span.SetAttributes(attribute.String("cache.status", CacheHit))
+			return newResult(item, cached, CacheHit, rendering{timings: Timings{Cache: cacheTime}}), nil
+		}
+
+		// Recently stale file is returned at once, while being refreshed in background.
+		if now.Before(item.FreshUntil.Add(app.Config.GetCacheStaleWhileRevalidate())) {
+			span.SetAttributes(attribute.String("cache.status", CacheStale))
+			app.refresh(ctx, cacheKey, width, height, url, headers)
+			return newResult(item, cached, CacheStale, rendering{timings: Timings{Cache: cacheTime}}), nil
+		}
+	} else {
+		item = nil
+	}
+
+	// Otherwise, render file, the stale one is kept open in case rendering fails.
+	span.SetAttributes(attribute.String("cache.status", CacheMiss))
+	rendered, err := app.render(ctx, cacheKey, width, height, url, headers)
+	rendered.timings.Cache += cacheTime
+
+	if err != nil {
+		// Stale file is better than nothing if the origin fails, unless it is too old.
+		if item != nil && time.Now().Before(item.FreshUntil.Add(app.Config.GetCacheMaxStale())) {
+			app.Logger.WarnContext(ctx, fmt.Sprintf("serving stale %s: %s", cacheKey, err))
+			span.SetAttributes(attribute.String("cache.status", CacheStaleIfError))
+			span.RecordError(err)
+			return newResult(item, cached, CacheStaleIfError, rendered), nil
+		}
+
+		cached.close()
+		recordError(span, err)
+
+		return nil, err
 	}
 
-	// Otherwise, download file.
-	sourceBytes, err := app.downloadByURL(url, headers)
+	cached.close()
+
+	// And return the result.
+	return newResult(rendered.item, newContent(rendered.item.Value), CacheMiss, rendered), nil
+}
+
+// render downloads and crops the image, storing the result in cache. The origin status is known
+// even if rendering fails, unless the origin couldn't be requested.
+func (app *Application) render(ctx context.Context, cacheKey string, width, height int, url string, headers map[string][]string) (rendering, error) {
+	var rendered rendering
+
+	// Download file.
+	start := time.Now()
+	downloaded := app.Metrics.DownloadStarted()
+	sourceBytes, originHeaders, originStatus, err := app.downloadByURL(ctx, url, headers)
+	downloaded(len(sourceBytes), err)
+
+	rendered.originStatus = originStatus
+	rendered.timings.Fetch = time.Since(start)
+
 	if err != nil {
-		return []byte{}, err
+		return rendered, err
 	}
 
+	rendered.sourceWidth, rendered.sourceHeight = sourceDimensions(sourceBytes)
+
 	// Process file.
-	resultBytes, err = app.Resizer.Resize(uint(width), uint(height), sourceBytes)
+	start = time.Now()
+	resultBytes, err := app.resize(ctx, width, height, sourceBytes)
+	rendered.timings.Resize = time.Since(start)
+
 	if err != nil {
-		return []byte{}, fmt.Errorf("%w: %s", ErrFileNotFound, err)
+		return rendered, fmt.Errorf("%w: %s", ErrFileNotFound, err)
 	}
 
-	// Set processed image in cache
-	_ = app.Cache.Set(cacheKey, resultBytes)
+	// Set processed image in cache, the item carries the hash used as ETag.
+	item := internalcache.NewItem(resultBytes)
+	item.Source = url
+
+	// Stale item is kept as long as it may be served.
+	ttl := app.ttl(originHeaders)
+	if ttl > 0 {
+		item.FreshUntil = item.ModTime.Add(ttl)
+		item.ExpiresAt = item.FreshUntil.Add(maxDuration(app.Config.GetCacheStaleWhileRevalidate(), app.Config.GetCacheMaxStale()))
+	}
+
+	// Origin may forbid caching at all, e.g. with max-age=0.
+	if ttl >= 0 {
+		start = time.Now()
+		app.cacheSet(ctx, cacheKey, item)
+		rendered.timings.Cache = time.Since(start)
+	} else {
+		rendered.noStore = true
+	}
+
+	rendered.item = item
+
+	return rendered, nil
+}
+
+// resize crops the image, observing the duration by format of the source.
+func (app *Application) resize(ctx context.Context, width, height int, sourceBytes []byte) ([]byte, error) {
+	format := sourceFormat(sourceBytes)
+
+	_, span := tracer.Start(ctx, "resizer.Resize", trace.WithAttributes(
+		attribute.String("image.format", format),
+		attribute.String("image.mode", ModeFill),
+		attribute.Int("image.size", len(sourceBytes)),
+	))
+	defer span.End()
+
+	resized := app.Metrics.ResizeStarted(format, ModeFill)
+	resultBytes, err := app.Resizer.Resize(uint(width), uint(height), sourceBytes)
+	resized()
+
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
 
-	// And return slice of bytes.
 	return resultBytes, nil
 }
 
-// downloadByURL downloads image by given url forwarding original headers.
-func (app *Application) downloadByURL(url string, headers map[string][]string) ([]byte, error) {
-	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, DefaultScheme+url, nil)
+// cacheGet gets the item from cache within a span. The item is streamed, unless the cache only supports
+// reading items into memory, then it is returned with the value.
+func (app *Application) cacheGet(ctx context.Context, cacheKey string) (*internalcache.Item, content, error) {
+	_, span := tracer.Start(ctx, "cache.Get", trace.WithAttributes(attribute.String("cache.key", cacheKey)))
+	defer span.End()
+
+	item, cached, err := app.cacheOpen(cacheKey)
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+
+	if err != nil {
+		return nil, content{}, err
+	}
+
+	span.SetAttributes(attribute.Int64("cache.size", cached.size))
+
+	return item, cached, nil
+}
+
+// cacheOpen opens the item from cache, measuring its size and detecting its type.
+func (app *Application) cacheOpen(cacheKey string) (*internalcache.Item, content, error) {
+	opener, ok := app.Cache.(internalcache.Opener)
+	if !ok {
+		item, err := app.Cache.Get(cacheKey)
+		if err != nil {
+			return nil, content{}, err
+		}
+
+		return item, newContent(item.Value), nil
+	}
+
+	item, body, err := opener.Open(cacheKey)
+	if err != nil {
+		return nil, content{}, err
+	}
+
+	cached, err := openContent(body)
+	if err != nil {
+		body.Close()
+		return nil, content{}, fmt.Errorf("%w: %s", ErrFileRead, err)
+	}
+
+	return item, cached, nil
+}
+
+// newContent returns the content of the image in memory.
+func newContent(image []byte) content {
+	width, height := imageDimensions(bytes.NewReader(image))
+
+	return content{bytes.NewReader(image), int64(len(image)), http.DetectContentType(image), width, height}
+}
+
+// openContent returns the content of the streamed image, reading as little of it as detection of the type
+// and dimensions needs.
+func openContent(body io.ReadSeeker) (content, error) {
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return content{}, err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return content{}, err
+	}
+
+	// Content type is detected by the first 512 bytes at most.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return content{}, err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return content{}, err
+	}
+
+	// Dimensions are read from the image header.
+	width, height := imageDimensions(body)
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return content{}, err
+	}
+
+	return content{body, size, http.DetectContentType(head[:n]), width, height}, nil
+}
+
+// close closes the body, if it is streamed.
+func (c content) close() {
+	if closer, ok := c.body.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// cacheSet stores the item in cache within a span, failures don't affect the response.
+func (app *Application) cacheSet(ctx context.Context, cacheKey string, item *internalcache.Item) {
+	_, span := tracer.Start(ctx, "cache.Set", trace.WithAttributes(
+		attribute.String("cache.key", cacheKey),
+		attribute.Int("cache.size", len(item.Value)),
+	))
+	defer span.End()
+
+	if err := app.Cache.Set(cacheKey, item); err != nil {
+		recordError(span, err)
+	}
+}
+
+// refresh renders the image in background, unless it is being refreshed already.
+// The refresh outlives the request, so it is traced on its own, linked to the request trace,
+// while log lines still carry the ID of the request.
+func (app *Application) refresh(ctx context.Context, cacheKey string, width, height int, url string, headers map[string][]string) {
+	if _, refreshing := app.refreshing.LoadOrStore(cacheKey, struct{}{}); refreshing {
+		return
+	}
+
+	link := trace.LinkFromContext(ctx)
+
+	go func() {
+		defer app.refreshing.Delete(cacheKey)
+
+		ctx, span := tracer.Start(detachedContext{ctx}, "app.refresh", trace.WithNewRoot(), trace.WithLinks(link))
+		defer span.End()
+
+		if _, err := app.render(ctx, cacheKey, width, height, url, headers); err != nil {
+			app.Logger.WarnContext(ctx, fmt.Sprintf("unable to refresh %s: %s", cacheKey, err))
+			recordError(span, err)
+		}
+	}()
+}
+
+// detachedContext keeps values of the parent context, but is never done.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// recordError marks the span failed.
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// PurgeAll removes every cached variant.
+func (app *Application) PurgeAll() {
+	app.Cache.Clear()
+}
+
+// PurgeURL removes every cached variant of the source URL, returning count of removed ones.
+// Variants are looked up in the source index, unless the backend doesn't maintain one.
+func (app *Application) PurgeURL(url string) (int, error) {
+	if indexer, ok := internalcache.SourceIndexerOf(app.Cache); ok {
+		return indexer.DeleteVariants(url), nil
+	}
+
+	admin, ok := internalcache.AdminOf(app.Cache)
+	if !ok {
+		return 0, ErrCacheAdmin
+	}
+
+	return admin.DeleteFunc(func(key string) bool {
+		transformKey, err := internalcache.ParseTransformKey(key)
+		return err == nil && transformKey.Source == url
+	}), nil
+}
+
+// Variants returns sorted cache keys of every cached variant of the source URL.
+func (app *Application) Variants(url string) ([]string, error) {
+	indexer, ok := internalcache.SourceIndexerOf(app.Cache)
+	if !ok {
+		return nil, ErrCacheAdmin
+	}
+
+	keys := indexer.Variants(url)
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// PurgePrefix removes cached variants, which source URLs start with the prefix, returning count of removed ones.
+func (app *Application) PurgePrefix(prefix string) (int, error) {
+	admin, ok := internalcache.AdminOf(app.Cache)
+	if !ok {
+		return 0, ErrCacheAdmin
+	}
+
+	keyPrefix := internalcache.SourcePrefix(prefix)
+
+	return admin.DeleteFunc(func(key string) bool {
+		return strings.HasPrefix(key, keyPrefix)
+	}), nil
+}
+
+// CacheStats returns cache counters.
+func (app *Application) CacheStats() (internalcache.Stats, error) {
+	admin, ok := internalcache.AdminOf(app.Cache)
+	if !ok {
+		return internalcache.Stats{}, ErrCacheAdmin
+	}
+
+	return admin.Stats(), nil
+}
+
+// CacheEntries returns a page of cached variants, which source URLs start with the prefix, ordered by keys,
+// along with the total count of such variants.
+func (app *Application) CacheEntries(prefix string, offset, limit int) ([]internalcache.Entry, int, error) {
+	admin, ok := internalcache.AdminOf(app.Cache)
+	if !ok {
+		return nil, 0, ErrCacheAdmin
+	}
+
+	keyPrefix := internalcache.SourcePrefix(prefix)
+
+	entries := make([]internalcache.Entry, 0)
+	for _, entry := range admin.Entries() {
+		if strings.HasPrefix(entry.Key, keyPrefix) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	total := len(entries)
+	if offset > total {
+		offset = total
+	}
+
+	if limit > total-offset {
+		limit = total - offset
+	}
+
+	return entries[offset : offset+limit], total, nil
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// newResult builds a result from the cache item and its content.
+func newResult(item *internalcache.Item, image content, cacheStatus string, rendered rendering) *Result {
+	return &Result{
+		Body:         image.body,
+		Size:         image.size,
+		ContentType:  image.contentType,
+		Width:        image.width,
+		Height:       image.height,
+		ETag:         item.Hash,
+		LastModified: item.ModTime,
+		CachePolicy:  CachePolicy{item.FreshUntil, rendered.noStore},
+		CacheStatus:  cacheStatus,
+		OriginStatus: rendered.originStatus,
+		Timings:      rendered.timings,
+		SourceWidth:  rendered.sourceWidth,
+		SourceHeight: rendered.sourceHeight,
+	}
+}
+
+// Close releases the image, if it is streamed from cache.
+func (r *Result) Close() error {
+	if closer, ok := r.Body.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// ttl returns lifetime of the cache item: the configured one, unless the origin is trusted
+// and specifies its own. Zero means the item never expires, negative one means it must not be cached.
+func (app *Application) ttl(originHeaders http.Header) time.Duration {
+	if app.Config.GetCacheOriginTTL() {
+		if ttl, ok := originTTL(originHeaders); ok {
+			if ttl <= 0 {
+				return -1
+			}
+
+			return ttl
+		}
+	}
+
+	return app.Config.GetCacheTTL()
+}
+
+// originTTL derives lifetime from Cache-Control s-maxage or max-age directives, or from Expires header.
+func originTTL(headers http.Header) (time.Duration, bool) {
+	directives := make(map[string]string)
+
+	for _, directive := range strings.Split(strings.ToLower(headers.Get("Cache-Control")), ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if len(parts) == 2 {
+			directives[parts[0]] = strings.Trim(parts[1], `"`)
+		} else {
+			directives[parts[0]] = ""
+		}
+	}
+
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, exists := directives[name]; exists {
+			return 0, true
+		}
+	}
+
+	// Shared cache directive takes precedence.
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if seconds, err := strconv.Atoi(directives[name]); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if expires := headers.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			// Invalid dates, such as "0", mean already expired.
+			return 0, true
+		}
+
+		return time.Until(expiresAt), true
+	}
+
+	return 0, false
+}
+
+// sourceDimensions returns dimensions of the source image.
+func sourceDimensions(image []byte) (int, int) {
+	return imageDimensions(bytes.NewReader(image))
+}
+
+// imageDimensions returns dimensions of JPEG, PNG and GIF images read from their headers, zeros for other formats.
+func imageDimensions(image io.Reader) (int, int) {
+	config, _, err := imagepkg.DecodeConfig(image)
+	if err != nil {
+		return 0, 0
+	}
+
+	return config.Width, config.Height
+}
+
+// sourceFormat returns the image format detected by content, e.g. "jpeg", keeping metric labels bounded.
+func sourceFormat(image []byte) string {
+	contentType := http.DetectContentType(image)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "unknown"
+	}
+
+	return strings.TrimPrefix(contentType, "image/")
+}
+
+// downloadByURL downloads image by given url forwarding original headers, returning response headers
+// and the status code as well.
+func (app *Application) downloadByURL(ctx context.Context, url string, headers map[string][]string) ([]byte, http.Header, int, error) {
+	ctx, span := tracer.Start(ctx, "origin.Download", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.method", http.MethodGet),
+		attribute.String("http.url", DefaultScheme+url),
+	))
+	defer span.End()
+
+	bytes, responseHeaders, status, err := app.download(ctx, url, headers)
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.status_code", status))
+	}
+
+	if err != nil {
+		recordError(span, err)
+		return []byte{}, nil, status, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response_content_length", len(bytes)))
+
+	return bytes, responseHeaders, status, nil
+}
+
+// download performs the request to the origin, carrying the trace context of the context.
+func (app *Application) download(ctx context.Context, url string, headers map[string][]string) ([]byte, http.Header, int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, DefaultScheme+url, nil)
 	if err != nil {
-		return []byte{}, fmt.Errorf("%w: %s", ErrRequest, err)
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrRequest, err)
 	}
 
 	// Forwarding original headers to remote server.
@@ -97,22 +703,61 @@ func (app *Application) downloadByURL(url string, headers map[string][]string) (
 		}
 	}
 
-	response, err := http.DefaultClient.Do(request)
+	for _, name := range clientOnlyHeaders {
+		request.Header.Del(name)
+	}
+
+	// Trace context of the client is replaced with the one of the download span.
+	propagator := otel.GetTextMapPropagator()
+	for _, field := range propagator.Fields() {
+		request.Header.Del(field)
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	response, err := app.Client.Do(request)
 	if err != nil {
 		// Identifying wrong domain name errors.
 		var DNSError *net.DNSError
 		if errors.As(err, &DNSError) {
-			return []byte{}, fmt.Errorf("%w: %s", ErrServerNotExists, err)
+			return nil, nil, 0, fmt.Errorf("%w: %s", ErrServerNotExists, err)
 		}
 
-		return []byte{}, fmt.Errorf("%w: %s", ErrDownload, err)
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrDownload, err)
 	}
 	defer response.Body.Close()
 
-	bytes, err := io.ReadAll(response.Body)
-	if err != nil {
-		return []byte{}, fmt.Errorf("%w: %s", ErrFileRead, err)
+	// Any other status, e.g. a partial content one, doesn't carry the whole image.
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return nil, nil, response.StatusCode, fmt.Errorf("%w: %s", ErrFileNotFound, response.Status)
+	case response.StatusCode != http.StatusOK:
+		return nil, nil, response.StatusCode, fmt.Errorf("%w: %s", ErrOriginStatus, response.Status)
+	}
+
+	maxSize := app.Config.GetOriginMaxSize()
+	if maxSize > 0 && response.ContentLength > maxSize {
+		return nil, nil, response.StatusCode, fmt.Errorf("%w: %d bytes", ErrFileTooLarge, response.ContentLength)
+	}
+
+	// Growing the buffer to the announced length at once spares copies of the growing body.
+	var buffer bytes.Buffer
+	if response.ContentLength > 0 {
+		buffer.Grow(int(response.ContentLength) + bytes.MinRead)
+	}
+
+	// The body is read up to one byte beyond the limit, so that larger files are told apart.
+	reader := io.Reader(response.Body)
+	if maxSize > 0 {
+		reader = io.LimitReader(response.Body, maxSize+1)
+	}
+
+	if _, err := buffer.ReadFrom(reader); err != nil {
+		return nil, nil, response.StatusCode, fmt.Errorf("%w: %s", ErrFileRead, err)
+	}
+
+	if maxSize > 0 && int64(buffer.Len()) > maxSize {
+		return nil, nil, response.StatusCode, fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, maxSize)
 	}
 
-	return bytes, nil
+	return buffer.Bytes(), response.Header, response.StatusCode, nil
 }
@@ -2,18 +2,32 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
+	"image/png"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	internalcache "github.com/spendmail/previewer/internal/cache"
 	internalconfig "github.com/spendmail/previewer/internal/config"
 	internallogger "github.com/spendmail/previewer/internal/logger"
+	internalmetrics "github.com/spendmail/previewer/internal/metrics"
 	internalresizer "github.com/spendmail/previewer/internal/resizer"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -36,12 +50,15 @@ func TestApplication(t *testing.T) {
 		cache, err := internalcache.New(config, logger)
 		require.NoError(t, err, "should be without errors")
 
-		app, err := New(logger, internalresizer.New(), cache)
+		app, err := New(config, logger, internalresizer.New(), cache, internalmetrics.New())
 		require.NoError(t, err, "should be without errors")
 
 		headers := map[string][]string{}
-		imageBytes, err := app.ResizeImageByURL(ImageWidth, ImageHeight, ImageURL, headers)
+		result, err := app.ResizeImageByURL(context.Background(), ImageWidth, ImageHeight, ImageURL, headers)
 		require.NoError(t, err, "should be without errors")
+		require.NotEmpty(t, result.ETag, "etag should be set")
+
+		imageBytes := readBody(t, result)
 
 		bytesContentType := http.DetectContentType(imageBytes)
 		require.Equal(t, ContentTypeImageJpeg, bytesContentType, fmt.Sprintf("content type should be %s, but %s given", ContentTypeImageJpeg, bytesContentType))
@@ -62,11 +79,11 @@ func TestApplication(t *testing.T) {
 		cache, err := internalcache.New(config, logger)
 		require.NoError(t, err, "should be without errors")
 
-		app, err := New(logger, internalresizer.New(), cache)
+		app, err := New(config, logger, internalresizer.New(), cache, internalmetrics.New())
 		require.NoError(t, err, "should be without errors")
 
 		headers := map[string][]string{}
-		_, err = app.ResizeImageByURL(ImageWidth, ImageHeight, WrongDNSURL, headers)
+		_, err = app.ResizeImageByURL(context.Background(), ImageWidth, ImageHeight, WrongDNSURL, headers)
 		require.Truef(t, errors.Is(err, ErrServerNotExists), "actual error %q", err)
 	})
 
@@ -80,11 +97,503 @@ func TestApplication(t *testing.T) {
 		cache, err := internalcache.New(config, logger)
 		require.NoError(t, err, "should be without errors")
 
-		app, err := New(logger, internalresizer.New(), cache)
+		app, err := New(config, logger, internalresizer.New(), cache, internalmetrics.New())
 		require.NoError(t, err, "should be without errors")
 
 		headers := map[string][]string{}
-		_, err = app.ResizeImageByURL(ImageWidth, ImageHeight, WrongImageURLPath, headers)
+		_, err = app.ResizeImageByURL(context.Background(), ImageWidth, ImageHeight, WrongImageURLPath, headers)
 		require.Truef(t, errors.Is(err, ErrFileNotFound), "actual error %q", err)
 	})
 }
+
+func TestOriginTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers http.Header
+		ttl     time.Duration
+		ok      bool
+	}{
+		{"no headers", http.Header{}, 0, false},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=60"}}, time.Minute, true},
+		{"s-maxage precedence", http.Header{"Cache-Control": {"max-age=60, s-maxage=3600"}}, time.Hour, true},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, 0, true},
+		{"invalid expires", http.Header{"Expires": {"0"}}, 0, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, ok := originTTL(tt.headers)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.ttl, ttl)
+		})
+	}
+
+	t.Run("expires", func(t *testing.T) {
+		headers := http.Header{"Expires": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}
+
+		ttl, ok := originTTL(headers)
+		require.True(t, ok)
+		require.InDelta(t, time.Hour.Seconds(), ttl.Seconds(), 2)
+	})
+}
+
+func TestCacheManagement(t *testing.T) {
+	newApp := func(t *testing.T) *Application {
+		t.Helper()
+
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err, "should be without errors")
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err, "should be without errors")
+
+		cache := internalcache.NewMemoryCache(1024)
+		for _, variant := range []struct {
+			url           string
+			width, height int
+		}{
+			{"example.com/a.jpg", 100, 100},
+			{"example.com/a.jpg", 200, 100},
+			{"example.com/a.jpg-copy.jpg", 100, 100},
+			{"example.com/b.jpg", 100, 100},
+		} {
+			key := fillKey(variant.url, variant.width, variant.height)
+			item := internalcache.NewItem([]byte(key))
+			item.Source = variant.url
+			require.NoError(t, cache.Set(key, item))
+		}
+
+		app, err := New(config, logger, internalresizer.New(), cache, internalmetrics.New())
+		require.NoError(t, err, "should be without errors")
+
+		return app
+	}
+
+	t.Run("purge url", func(t *testing.T) {
+		app := newApp(t)
+
+		// Variants of a URL sharing the prefix must survive.
+		purged, err := app.PurgeURL("example.com/a.jpg")
+		require.NoError(t, err)
+		require.Equal(t, 2, purged)
+
+		_, total, err := app.CacheEntries("", 0, 10)
+		require.NoError(t, err)
+		require.Equal(t, 2, total)
+	})
+
+	t.Run("variants", func(t *testing.T) {
+		app := newApp(t)
+
+		keys, err := app.Variants("example.com/a.jpg")
+		require.NoError(t, err)
+		require.Equal(t, []string{fillKey("example.com/a.jpg", 100, 100), fillKey("example.com/a.jpg", 200, 100)}, keys)
+	})
+
+	t.Run("purge prefix", func(t *testing.T) {
+		app := newApp(t)
+
+		purged, err := app.PurgePrefix("example.com/a.jpg")
+		require.NoError(t, err)
+		require.Equal(t, 3, purged)
+	})
+
+	t.Run("entries pagination", func(t *testing.T) {
+		app := newApp(t)
+
+		entries, total, err := app.CacheEntries("example.com/", 1, 2)
+		require.NoError(t, err)
+		require.Equal(t, 4, total)
+		require.Len(t, entries, 2)
+		require.Equal(t, fillKey("example.com/a.jpg", 200, 100), entries[0].Key)
+
+		entries, total, err = app.CacheEntries("example.com/", 10, 2)
+		require.NoError(t, err)
+		require.Equal(t, 4, total)
+		require.Empty(t, entries)
+	})
+
+	t.Run("unsupported backend", func(t *testing.T) {
+		app := newApp(t)
+		app.Cache = internalcache.NewS3CacheWithClient(nil, "", "", app.Logger)
+
+		// S3 indexes variants by sources, but doesn't support management otherwise.
+		_, err := app.PurgePrefix("example.com/")
+		require.Truef(t, errors.Is(err, ErrCacheAdmin), "actual error %q", err)
+
+		_, err = app.CacheStats()
+		require.Truef(t, errors.Is(err, ErrCacheAdmin), "actual error %q", err)
+	})
+}
+
+func fillKey(url string, width, height int) string {
+	return internalcache.TransformKey{Source: url, Mode: ModeFill, Width: width, Height: height}.String()
+}
+
+// readBody reads the whole image of the result and closes it.
+func readBody(t *testing.T, result *Result) []byte {
+	t.Helper()
+
+	defer result.Close()
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.Len(t, body, int(result.Size))
+
+	return body
+}
+
+// echoResizer returns source images as they are.
+type echoResizer struct{}
+
+func (echoResizer) Resize(width, height uint, image []byte) ([]byte, error) {
+	return image, nil
+}
+
+func TestStaleItems(t *testing.T) {
+	newApp := func(t *testing.T) (*Application, *internalcache.MemoryCache) {
+		t.Helper()
+
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err, "should be without errors")
+		config.Origin.Timeout = 100 * time.Millisecond
+		config.Cache.StaleWhileRevalidate = time.Minute
+		config.Cache.MaxStale = time.Hour
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err, "should be without errors")
+
+		cache := internalcache.NewMemoryCache(1024)
+
+		app, err := New(config, logger, echoResizer{}, cache, internalmetrics.New())
+		require.NoError(t, err, "should be without errors")
+
+		return app, cache
+	}
+
+	// setStale puts an item, which has become stale the given time ago.
+	setStale := func(t *testing.T, cache *internalcache.MemoryCache, url string, age time.Duration) {
+		t.Helper()
+
+		item := internalcache.NewItem([]byte("stale"))
+		item.FreshUntil = time.Now().Add(-age)
+		item.ExpiresAt = time.Now().Add(time.Hour)
+		require.NoError(t, cache.Set(fillKey(url, 1, 1), item))
+	}
+
+	t.Run("stale while revalidate", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("fresh"))
+		}))
+		defer origin.Close()
+
+		app, cache := newApp(t)
+		url := strings.TrimPrefix(origin.URL, DefaultScheme) + "/image.jpg"
+		setStale(t, cache, url, time.Second)
+
+		result, err := app.ResizeImageByURL(context.Background(), 1, 1, url, map[string][]string{})
+		require.NoError(t, err)
+		require.Equal(t, []byte("stale"), readBody(t, result))
+		require.Equal(t, CacheStale, result.CacheStatus)
+
+		require.Eventually(t, func() bool {
+			item, err := cache.Get(fillKey(url, 1, 1))
+			return err == nil && string(item.Value) == "fresh"
+		}, time.Second, 10*time.Millisecond)
+
+		result, err = app.ResizeImageByURL(context.Background(), 1, 1, url, map[string][]string{})
+		require.NoError(t, err)
+		require.Equal(t, CacheHit, result.CacheStatus)
+		require.Zero(t, result.OriginStatus)
+	})
+
+	t.Run("stale if error", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Origin is slower than the timeout.
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer origin.Close()
+
+		app, cache := newApp(t)
+		url := strings.TrimPrefix(origin.URL, DefaultScheme) + "/image.jpg"
+
+		// Stale item is too old to be served without revalidation, but is served when the origin fails.
+		setStale(t, cache, url, 10*time.Minute)
+
+		result, err := app.ResizeImageByURL(context.Background(), 1, 1, url, map[string][]string{})
+		require.NoError(t, err)
+		require.Equal(t, []byte("stale"), readBody(t, result))
+		require.Equal(t, CacheStaleIfError, result.CacheStatus)
+
+		// Too stale item is not served.
+		setStale(t, cache, url, 2*time.Hour)
+
+		_, err = app.ResizeImageByURL(context.Background(), 1, 1, url, map[string][]string{})
+		require.Truef(t, errors.Is(err, ErrDownload), "actual error %q", err)
+	})
+}
+
+func TestWarmup(t *testing.T) {
+	t.Run("parse item", func(t *testing.T) {
+		item, err := ParseWarmupItem("/fill/300/200/example.com/image.jpg?size=large")
+		require.NoError(t, err)
+		require.Equal(t, WarmupItem{300, 200, "example.com/image.jpg?size=large"}, item)
+
+		item, err = ParseWarmupItem("fill/30/20/example.com/image.jpg")
+		require.NoError(t, err)
+		require.Equal(t, WarmupItem{30, 20, "example.com/image.jpg"}, item)
+
+		for _, line := range []string{"", "example.com/image.jpg", "/crop/300/200/example.com/image.jpg", "/fill/0/200/example.com/image.jpg", "/fill/300/200/"} {
+			_, err = ParseWarmupItem(line)
+			require.Truef(t, errors.Is(err, ErrWarmupParse), "line %q, actual error %q", line, err)
+		}
+	})
+
+	t.Run("bounded concurrency", func(t *testing.T) {
+		var running, maxRunning int32
+
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			for {
+				current := atomic.LoadInt32(&maxRunning)
+				if n <= current || atomic.CompareAndSwapInt32(&maxRunning, current, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			_, _ = w.Write([]byte(r.URL.Path))
+		}))
+		defer origin.Close()
+
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err, "should be without errors")
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err, "should be without errors")
+
+		app, err := New(config, logger, echoResizer{}, internalcache.NewMemoryCache(1024), internalmetrics.New())
+		require.NoError(t, err, "should be without errors")
+
+		host := strings.TrimPrefix(origin.URL, DefaultScheme)
+		items := make([]WarmupItem, 0)
+		for i := 0; i < 10; i++ {
+			items = append(items, WarmupItem{1, 1, fmt.Sprintf("%s/%d.jpg", host, i)})
+		}
+
+		results := app.Warmup(context.Background(), items, 3)
+		require.Len(t, results, 10)
+		require.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(3))
+
+		for i, result := range results {
+			require.NoError(t, result.Err)
+			require.Equal(t, items[i], result.Item)
+			require.Equal(t, len(fmt.Sprintf("/%d.jpg", i)), result.Bytes)
+		}
+
+		// Nothing is started once the context is done.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results = app.Warmup(ctx, items, 3)
+		for _, result := range results {
+			require.Truef(t, errors.Is(result.Err, context.Canceled), "actual error %q", result.Err)
+		}
+	})
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("spans and propagation", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+		var traceparent string
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparent = r.Header.Get("traceparent")
+			_, _ = w.Write([]byte("image"))
+		}))
+		defer origin.Close()
+
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err, "should be without errors")
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err, "should be without errors")
+
+		app, err := New(config, logger, echoResizer{}, internalcache.NewMemoryCache(1024), internalmetrics.New())
+		require.NoError(t, err, "should be without errors")
+
+		// Incoming trace context, e.g. extracted from a traceparent header, is continued.
+		incoming := http.Header{"Traceparent": []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+		ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(incoming))
+
+		result, err := app.ResizeImageByURL(ctx, 1, 1, strings.TrimPrefix(origin.URL, DefaultScheme)+"/a.jpg", incoming)
+		require.NoError(t, err)
+		require.Equal(t, CacheMiss, result.CacheStatus)
+		require.Equal(t, http.StatusOK, result.OriginStatus)
+
+		// The origin gets the trace context of the download span rather than the forwarded one.
+		require.True(t, strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"), traceparent)
+		require.NotEqual(t, incoming.Get("traceparent"), traceparent)
+
+		names := make([]string, 0)
+		for _, span := range recorder.Ended() {
+			require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+			names = append(names, span.Name())
+		}
+		require.ElementsMatch(t, []string{"app.ResizeImageByURL", "cache.Get", "origin.Download", "resizer.Resize", "cache.Set"}, names)
+	})
+}
+
+func TestReadiness(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/canary.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer origin.Close()
+
+	config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+	require.NoError(t, err, "should be without errors")
+	config.Cache.Backend = internalcache.BackendFilesystem
+	config.Cache.Path = t.TempDir()
+
+	logger, err := internallogger.New(config)
+	require.NoError(t, err, "should be without errors")
+
+	cache, err := internalcache.New(config, logger)
+	require.NoError(t, err, "should be without errors")
+
+	app, err := New(config, logger, echoResizer{}, cache, internalmetrics.New())
+	require.NoError(t, err, "should be without errors")
+
+	t.Run("without canary", func(t *testing.T) {
+		config.Health.CanaryURL = ""
+
+		// Resizer, which can't be checked, is considered ready.
+		require.Equal(t, []Check{{CheckCache, nil}}, app.Readiness(context.Background()))
+	})
+
+	t.Run("canary", func(t *testing.T) {
+		config.Health.CanaryURL = strings.TrimPrefix(origin.URL, DefaultScheme) + "/canary.jpg"
+		require.Equal(t, []Check{{CheckCache, nil}, {CheckOrigin, nil}}, app.Readiness(context.Background()))
+
+		config.Health.CanaryURL = strings.TrimPrefix(origin.URL, DefaultScheme) + "/missing.jpg"
+		checks := app.Readiness(context.Background())
+		require.Len(t, checks, 2)
+		require.Truef(t, errors.Is(checks[1].Err, ErrOriginCheck), "actual error %q", checks[1].Err)
+	})
+}
+
+func TestResult(t *testing.T) {
+	source := &bytes.Buffer{}
+	require.NoError(t, png.Encode(source, image.NewRGBA(image.Rect(0, 0, 40, 30))))
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Origin answers ranges and conditions, the way file servers do.
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(source.Bytes()))
+	}))
+	defer origin.Close()
+
+	config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+	require.NoError(t, err, "should be without errors")
+
+	logger, err := internallogger.New(config)
+	require.NoError(t, err, "should be without errors")
+
+	// Filesystem cache streams hits.
+	config.Cache.Path = t.TempDir()
+	cache, err := internalcache.NewLruCache(config, logger)
+	require.NoError(t, err, "should be without errors")
+
+	app, err := New(config, logger, echoResizer{}, cache, internalmetrics.New())
+	require.NoError(t, err, "should be without errors")
+
+	url := strings.TrimPrefix(origin.URL, DefaultScheme) + "/image.png"
+
+	t.Run("miss", func(t *testing.T) {
+		result, err := app.ResizeImageByURL(context.Background(), 1, 1, url, map[string][]string{})
+		require.NoError(t, err)
+		require.Equal(t, CacheMiss, result.CacheStatus)
+		require.Equal(t, "image/png", result.ContentType)
+		// Dimensions are the actual ones, the echo resizer keeps the source as it is.
+		require.Equal(t, 40, result.Width)
+		require.Equal(t, 30, result.Height)
+		require.WithinDuration(t, time.Now().Add(config.GetCacheTTL()), result.CachePolicy.FreshUntil, time.Minute)
+		require.False(t, result.CachePolicy.NoStore)
+		require.Equal(t, 40, result.SourceWidth)
+		require.Equal(t, 30, result.SourceHeight)
+		require.Equal(t, source.Bytes(), readBody(t, result))
+		require.Positive(t, result.Timings.Cache)
+		require.Positive(t, result.Timings.Fetch)
+		require.Positive(t, result.Timings.Resize)
+	})
+
+	t.Run("hit", func(t *testing.T) {
+		result, err := app.ResizeImageByURL(context.Background(), 1, 1, url, map[string][]string{})
+		require.NoError(t, err)
+		require.Equal(t, CacheHit, result.CacheStatus)
+		require.IsType(t, &os.File{}, result.Body)
+		require.Equal(t, "image/png", result.ContentType)
+		require.Equal(t, source.Bytes(), readBody(t, result))
+		require.Equal(t, 40, result.Width)
+		require.Equal(t, 30, result.Height)
+		require.Zero(t, result.SourceWidth)
+		require.Positive(t, result.Timings.Cache)
+		require.Zero(t, result.Timings.Fetch)
+		require.Zero(t, result.Timings.Resize)
+	})
+
+	t.Run("range on miss", func(t *testing.T) {
+		headers := map[string][]string{
+			"Range":    {"bytes=0-9"},
+			"If-Range": {`"etag"`},
+			"If-Match": {`"etag"`},
+		}
+
+		result, err := app.ResizeImageByURL(context.Background(), 3, 3, url, headers)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, result.OriginStatus)
+		require.Equal(t, source.Bytes(), readBody(t, result))
+	})
+
+	t.Run("origin status", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(source.Bytes()[:10])
+		}))
+		defer origin.Close()
+
+		_, err := app.ResizeImageByURL(context.Background(), 1, 1, strings.TrimPrefix(origin.URL, DefaultScheme)+"/image.png", map[string][]string{})
+		require.Truef(t, errors.Is(err, ErrOriginStatus), "actual error %q", err)
+	})
+
+	t.Run("no store", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write(source.Bytes())
+		}))
+		defer origin.Close()
+
+		config.Cache.OriginTTL = true
+		defer func() { config.Cache.OriginTTL = false }()
+
+		result, err := app.ResizeImageByURL(context.Background(), 1, 1, strings.TrimPrefix(origin.URL, DefaultScheme)+"/image.png", map[string][]string{})
+		require.NoError(t, err)
+		require.True(t, result.CachePolicy.NoStore)
+		require.Equal(t, source.Bytes(), readBody(t, result))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		config.Origin.MaxSize = int64(source.Len() - 1)
+		defer func() { config.Origin.MaxSize = 0 }()
+
+		_, err := app.ResizeImageByURL(context.Background(), 2, 2, url, map[string][]string{})
+		require.Truef(t, errors.Is(err, ErrFileTooLarge), "actual error %q", err)
+	})
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	CheckCache   = "cache"
+	CheckResizer = "resizer"
+	CheckOrigin  = "origin"
+)
+
+var ErrOriginCheck = errors.New("origin is unavailable")
+
+// Checker is implemented by dependencies, which are able to tell whether they are available.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Check is an outcome of a readiness check, Err is nil if the check passed.
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Readiness checks whether previews can be served: the cache is able to store items, the resizer
+// is initialized and, if the canary URL is configured, the origin is reachable.
+func (app *Application) Readiness(ctx context.Context) []Check {
+	if timeout := app.Config.GetHealthTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	checks := make([]Check, 0, 3)
+
+	if checker, ok := app.Cache.(Checker); ok {
+		checks = append(checks, Check{CheckCache, checker.Check(ctx)})
+	}
+
+	if checker, ok := app.Resizer.(Checker); ok {
+		checks = append(checks, Check{CheckResizer, checker.Check(ctx)})
+	}
+
+	if canary := app.Config.GetHealthCanaryURL(); canary != "" {
+		checks = append(checks, Check{CheckOrigin, app.checkOrigin(ctx, canary)})
+	}
+
+	return checks
+}
+
+// checkOrigin requests headers of the canary image, so that the image itself isn't downloaded.
+func (app *Application) checkOrigin(ctx context.Context, url string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, DefaultScheme+url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrOriginCheck, err)
+	}
+
+	response, err := app.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrOriginCheck, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%w: %s", ErrOriginCheck, response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultWarmupConcurrency = 4
+)
+
+var ErrWarmupParse = errors.New("unable to parse warmup item")
+
+// WarmupItem is a variant to be rendered ahead of requests.
+type WarmupItem struct {
+	Width  int
+	Height int
+	URL    string
+}
+
+// WarmupResult is an outcome of rendering a warmup item.
+type WarmupResult struct {
+	Item  WarmupItem
+	Bytes int
+	Err   error
+}
+
+// ParseWarmupItem parses an item written the way it is requested, e.g. "/fill/300/200/example.com/image.jpg".
+func ParseWarmupItem(line string) (WarmupItem, error) {
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(line), "/"), "/", 4)
+	if len(parts) != 4 || parts[0] != ModeFill || parts[3] == "" {
+		return WarmupItem{}, fmt.Errorf("%w: %s", ErrWarmupParse, line)
+	}
+
+	width, err := strconv.Atoi(parts[1])
+	if err != nil || width <= 0 {
+		return WarmupItem{}, fmt.Errorf("%w: %s", ErrWarmupParse, line)
+	}
+
+	height, err := strconv.Atoi(parts[2])
+	if err != nil || height <= 0 {
+		return WarmupItem{}, fmt.Errorf("%w: %s", ErrWarmupParse, line)
+	}
+
+	return WarmupItem{width, height, parts[3]}, nil
+}
+
+// Warmup renders items, at most concurrency of them at once, returning results in order of items.
+// Items, which haven't been started before the context is done, fail with the context error.
+func (app *Application) Warmup(ctx context.Context, items []WarmupItem, concurrency int) []WarmupResult {
+	if concurrency <= 0 {
+		concurrency = DefaultWarmupConcurrency
+	}
+
+	results := make([]WarmupResult, len(items))
+	semaphore := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		results[i].Item = item
+
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case semaphore <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(result *WarmupResult) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// Origin headers aren't known ahead of requests.
+			rendered, err := app.ResizeImageByURL(ctx, result.Item.Width, result.Item.Height, result.Item.URL, map[string][]string{})
+			if err != nil {
+				result.Err = err
+				return
+			}
+
+			rendered.Close()
+			result.Bytes = int(rendered.Size)
+		}(&results[i])
+	}
+
+	wg.Wait()
+
+	return results
+}
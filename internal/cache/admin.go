@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"time"
+)
+
+// Admin is implemented by backends, which support cache management.
+type Admin interface {
+	Delete(key string) bool
+	DeleteFunc(match func(key string) bool) int
+	Entries() []Entry
+	Stats() Stats
+}
+
+// AdminOf returns management of the cache, if it supports one. A tiered cache supports it only if
+// its L2 does, since L1 holds a subset of items: managing L1 alone would report partial results.
+func AdminOf(c Cache) (Admin, bool) {
+	if tiered, ok := c.(*TieredCache); ok {
+		if _, ok := tiered.l2.(Admin); !ok {
+			return nil, false
+		}
+	}
+
+	admin, ok := c.(Admin)
+
+	return admin, ok
+}
+
+// Entry describes a cached item without its value.
+type Entry struct {
+	Key       string
+	Size      int64
+	Hash      string
+	ModTime   time.Time
+	ExpiresAt time.Time
+	Source    string
+}
+
+// HitRatio returns share of hits among all lookups.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
@@ -0,0 +1,168 @@
+package cache
+
+const (
+	arcT1 = iota
+	arcT2
+	arcB1
+	arcB2
+)
+
+// ARCPolicy is an Adaptive Replacement Cache policy: keys seen once live in T1, keys seen
+// at least twice live in T2. Ghost lists B1 and B2 remember recently evicted keys, and hits
+// in them adapt the target size of T1, balancing recency against frequency. Since a scan
+// only passes through T1, frequently used keys in T2 survive it.
+type ARCPolicy struct {
+	capacity int
+	target   int
+	lists    [4]List
+	items    map[string]*ListItem
+}
+
+type arcEntry struct {
+	key  string
+	list int
+}
+
+// NewARCPolicy is an ARC policy constructor.
+func NewARCPolicy(capacity int) *ARCPolicy {
+	return &ARCPolicy{
+		capacity: capacity,
+		lists:    [4]List{NewList(), NewList(), NewList(), NewList()},
+		items:    make(map[string]*ListItem, 2*capacity),
+	}
+}
+
+// Access moves a resident key to the front of T2.
+func (p *ARCPolicy) Access(key string) {
+	item, exists := p.items[key]
+	if !exists || item.Value.(*arcEntry).list > arcT2 {
+		return
+	}
+
+	p.move(item, arcT2)
+}
+
+// Add puts key to T1, or to T2 if it has been evicted recently, adapting the target size of T1.
+func (p *ARCPolicy) Add(key string) (bool, []string) {
+	if p.capacity <= 0 {
+		return false, nil
+	}
+
+	var evicted []string
+
+	if item, exists := p.items[key]; exists {
+		switch item.Value.(*arcEntry).list {
+		case arcB1:
+			p.target = minInt(p.capacity, p.target+maxInt(p.lists[arcB2].Len()/p.lists[arcB1].Len(), 1))
+			evicted = p.replace(false)
+		case arcB2:
+			p.target = maxInt(0, p.target-maxInt(p.lists[arcB1].Len()/p.lists[arcB2].Len(), 1))
+			evicted = p.replace(true)
+		default:
+			// Resident key is just accessed.
+			p.Access(key)
+			return true, nil
+		}
+
+		p.move(item, arcT2)
+
+		return true, evicted
+	}
+
+	t1, b1 := p.lists[arcT1].Len(), p.lists[arcB1].Len()
+	total := t1 + b1 + p.lists[arcT2].Len() + p.lists[arcB2].Len()
+
+	switch {
+	case t1+b1 >= p.capacity:
+		if t1 < p.capacity {
+			p.drop(arcB1)
+			evicted = p.replace(false)
+		} else {
+			evicted = []string{p.drop(arcT1)}
+		}
+	case total >= p.capacity:
+		if total >= 2*p.capacity {
+			p.drop(arcB2)
+		}
+		evicted = p.replace(false)
+	}
+
+	p.items[key] = p.lists[arcT1].PushFront(&arcEntry{key, arcT1})
+
+	return true, evicted
+}
+
+// Remove forgets a key.
+func (p *ARCPolicy) Remove(key string) {
+	if item, exists := p.items[key]; exists {
+		p.lists[item.Value.(*arcEntry).list].Remove(item)
+		delete(p.items, key)
+	}
+}
+
+// Len returns count of resident keys.
+func (p *ARCPolicy) Len() int {
+	return p.lists[arcT1].Len() + p.lists[arcT2].Len()
+}
+
+// replace evicts a resident key from T1 or T2 depending on the target, remembering it in the ghost list.
+// Nothing is evicted while there is room, which is possible after keys have been removed.
+func (p *ARCPolicy) replace(hitInB2 bool) []string {
+	if p.Len() < p.capacity {
+		return nil
+	}
+
+	t1 := p.lists[arcT1].Len()
+
+	from, to := arcT2, arcB2
+	if t1 > 0 && (t1 > p.target || (hitInB2 && t1 == p.target) || p.lists[arcT2].Len() == 0) {
+		from, to = arcT1, arcB1
+	}
+
+	back := p.lists[from].Back()
+	if back == nil {
+		return nil
+	}
+
+	p.move(back, to)
+
+	return []string{back.Value.(*arcEntry).key}
+}
+
+// drop forgets the LRU key of the list.
+func (p *ARCPolicy) drop(list int) string {
+	back := p.lists[list].Back()
+	if back == nil {
+		return ""
+	}
+
+	key := back.Value.(*arcEntry).key
+	p.Remove(key)
+
+	return key
+}
+
+// move puts the entry to the front of another list.
+func (p *ARCPolicy) move(item *ListItem, list int) {
+	entry := item.Value.(*arcEntry)
+
+	p.lists[entry.list].Remove(item)
+	entry.list = list
+	p.items[entry.key] = p.lists[list].PushFront(entry)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
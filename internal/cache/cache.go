@@ -1,18 +1,54 @@
 package cache
 
 import (
-	"encoding/base64"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// metaSuffix is a suffix of sidecar files, holding the original key and item metadata.
+	metaSuffix = ".meta"
+	// tmpPrefix is a prefix of files being written, they are renamed once complete.
+	tmpPrefix = ".tmp-"
+	// versionLength is a length of the content hash part of file names.
+	versionLength = 16
+)
+
+const (
+	BackendFilesystem = "filesystem"
+	BackendMemory     = "memory"
+	BackendS3         = "s3"
+	BackendRedis      = "redis"
 )
 
 type Config interface {
 	GetCacheCapacity() int64
 	GetCachePath() string
+	GetCacheShards() int
+	GetCachePolicy() string
+	GetCacheBackend() string
+	GetCacheMemoryBytes() int64
+	GetCacheJanitorInterval() time.Duration
+	GetCacheS3Bucket() string
+	GetCacheS3Prefix() string
+	GetCacheS3Region() string
+	GetCacheS3Endpoint() string
+	GetCacheS3AccessKey() string
+	GetCacheS3SecretKey() string
+	GetCacheS3PathStyle() bool
+	GetCacheRedisAddress() string
+	GetCacheRedisPassword() string
+	GetCacheRedisDB() int
+	GetCacheRedisPrefix() string
 }
 
 type Logger interface {
@@ -22,135 +58,457 @@ type Logger interface {
 	Error(args ...interface{})
 }
 
+// Cache is implemented by every cache backend.
+type Cache interface {
+	Set(key string, item *Item) error
+	Get(key string) (*Item, error)
+	Clear()
+}
+
+// LruCache is a filesystem cache, which evicts least recently used items unless another policy is configured.
 type LruCache struct {
-	capacity int64
-	queue    List
-	items    map[string]*ListItem
-	path     string
-	logger   Logger
-	mutex    sync.Mutex
+	capacity   int64
+	policyName string
+	policy     Policy
+	items      map[string]cacheItem
+	sources    sourceIndex
+	size       int64
+	path       string
+	logger     Logger
+	mutex      sync.Mutex
+	stats      Stats
+}
+
+// Stats holds cache counters.
+type Stats struct {
+	Items     int64
+	Bytes     int64
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
 }
 
 type cacheItem struct {
-	key   string
-	value string
+	key        string
+	value      string
+	hash       string
+	size       int64
+	modTime    time.Time
+	expiresAt  time.Time
+	freshUntil time.Time
+	source     string
+}
+
+// fileMeta is a sidecar file content, it allows to restore the index from the cache directory.
+type fileMeta struct {
+	Key        string    `json:"key"`
+	Hash       string    `json:"hash"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	FreshUntil time.Time `json:"fresh_until"`
+	Source     string    `json:"source,omitempty"`
+}
+
+// Item is a cache entry: the value itself and its metadata, which is kept in the index
+// so that it doesn't have to be recomputed on every hit.
+type Item struct {
+	Value   []byte
+	Hash    string
+	ModTime time.Time
+	// ExpiresAt is a moment the item expires at, zero value means it never does.
+	ExpiresAt time.Time
+	// FreshUntil is a moment the item becomes stale at: it is still stored until it expires,
+	// but should be revalidated. Zero value means it never becomes stale.
+	FreshUntil time.Time
+	// Source identifies what the item is derived from, e.g. the original image URL, it is optional.
+	Source string
 }
 
 var (
-	ErrFileWrite     = errors.New("unable to write file to filesystem")
-	ErrFileRemove    = errors.New("unable to remove file from filesystem")
-	ErrFileRead      = errors.New("unable to read file from filesystem")
-	ErrItemNotExists = errors.New("cache item does not exist")
+	ErrFileWrite      = errors.New("unable to write file to filesystem")
+	ErrFileRemove     = errors.New("unable to remove file from filesystem")
+	ErrFileRead       = errors.New("unable to read file from filesystem")
+	ErrItemNotExists  = errors.New("cache item does not exist")
+	ErrItemCorrupted  = errors.New("cache item is corrupted")
+	ErrUnknownBackend = errors.New("unknown cache backend")
 )
 
-// New is a cache constructor: returns lruCache instance pointer.
-func New(config Config, logger Logger) (*LruCache, error) {
-	cache := LruCache{
-		capacity: config.GetCacheCapacity(),
-		path:     config.GetCachePath(),
-		queue:    NewList(),
-		items:    make(map[string]*ListItem, config.GetCacheCapacity()),
-		logger:   logger,
+// New is a cache constructor: returns the backend chosen by config.
+// Unless the backend is in-memory itself, a positive memory budget puts an in-memory L1 in front of it.
+func New(config Config, logger Logger) (Cache, error) {
+	var (
+		backend Cache
+		err     error
+	)
+
+	switch config.GetCacheBackend() {
+	case BackendFilesystem, "":
+		if config.GetCacheShards() > 1 {
+			backend, err = NewShardedCache(config, logger)
+		} else {
+			backend, err = NewLruCache(config, logger)
+		}
+	case BackendMemory:
+		return NewMemoryCache(config.GetCacheMemoryBytes()), nil
+	case BackendS3:
+		backend, err = NewS3Cache(config, logger)
+	case BackendRedis:
+		backend, err = NewRedisCache(config, logger)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, config.GetCacheBackend())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.GetCacheMemoryBytes() > 0 {
+		return NewTieredCache(NewMemoryCache(config.GetCacheMemoryBytes()), backend), nil
+	}
+
+	return backend, nil
+}
+
+// NewLruCache is a filesystem cache constructor: returns lruCache instance pointer.
+func NewLruCache(config Config, logger Logger) (*LruCache, error) {
+	cache, err := newLruCache(config.GetCacheCapacity(), config.GetCachePath(), config.GetCachePolicy(), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := cache.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	cache.load(restored)
+
+	return cache, nil
+}
+
+// newLruCache creates an empty cache, without touching the filesystem.
+func newLruCache(capacity int64, path, policyName string, logger Logger) (*LruCache, error) {
+	policy, err := NewPolicy(policyName, int(capacity))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LruCache{
+		capacity:   capacity,
+		policyName: policyName,
+		policy:     policy,
+		path:       path,
+		items:      make(map[string]cacheItem, capacity),
+		sources:    make(sourceIndex),
+		logger:     logger,
+	}, nil
+}
+
+// prepare creates the cache directory, migrates legacy files and returns items found in it.
+func (l *LruCache) prepare() ([]restoredItem, error) {
+	err := os.MkdirAll(l.path, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files written by previous versions are moved to the current layout first.
+	if err := l.migrateLegacyFiles(); err != nil {
+		return nil, err
+	}
+
+	return l.scan()
+}
+
+// NewItem creates a cache item for the given value, calculating its content hash.
+func NewItem(value []byte) *Item {
+	sum := sha256.Sum256(value)
+
+	return &Item{
+		Value:   value,
+		Hash:    hex.EncodeToString(sum[:]),
+		ModTime: time.Now().UTC().Truncate(time.Second),
 	}
+}
+
+// Expired checks whether the item is expired at the given moment.
+func (i *Item) Expired(now time.Time) bool {
+	return isExpired(i.ExpiresAt, now)
+}
+
+// Fresh checks whether the item is not stale yet at the given moment.
+func (i *Item) Fresh(now time.Time) bool {
+	return !isExpired(i.FreshUntil, now)
+}
 
-	err := os.MkdirAll(cache.path, os.ModePerm)
+// isExpired checks whether the expiration moment has come, zero value means never.
+func isExpired(expiresAt, now time.Time) bool {
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// Get is a LruCache getter: returns item if exists, or error, if doesnt.
+// The mutex guards the index only, the file is read without holding it.
+func (l *LruCache) Get(key string) (*Item, error) {
+	cacheItemElement, err := l.lookup(key)
 	if err != nil {
 		return nil, err
 	}
 
-	return &cache, nil
+	// Reading from filesystem, unreadable or corrupted files are evicted and treated as misses
+	value, err := l.readFromFileSystem(cacheItemElement.value)
+	if err == nil {
+		err = verify(value, cacheItemElement.size, cacheItemElement.hash)
+	}
+	if err != nil {
+		l.evictIfUnchanged(cacheItemElement, err)
+		atomic.AddUint64(&l.stats.Misses, 1)
+
+		return nil, fmt.Errorf("%w: %s", ErrItemNotExists, err)
+	}
+
+	atomic.AddUint64(&l.stats.Hits, 1)
+
+	item := cacheItemElement.item()
+	item.Value = value
+
+	return item, nil
 }
 
-// Get is a LruCache getter: returns value if exists, or error, if doesnt.
-func (l *LruCache) Get(key string) ([]byte, error) {
+// lookup returns the index element of the key, unless it doesn't exist or is expired.
+// The policy is let know about the hit, misses are counted.
+func (l *LruCache) lookup(key string) (cacheItem, error) {
 	l.mutex.Lock()
-	defer l.mutex.Unlock()
 
-	item, exists := l.items[key]
+	cacheItemElement, exists := l.items[key]
 
-	// If cache element doesn't exist, return empty slice
+	// If cache element doesn't exist, return nil
 	if !exists {
-		return []byte{}, ErrItemNotExists
+		l.mutex.Unlock()
+		atomic.AddUint64(&l.stats.Misses, 1)
+
+		return cacheItem{}, ErrItemNotExists
 	}
 
-	// If cache element exists, move it to front
-	l.queue.MoveToFront(item)
+	// Expired elements are evicted on access, even if the janitor hasn't got to them yet
+	if isExpired(cacheItemElement.expiresAt, time.Now()) {
+		l.unlink(key)
+		l.mutex.Unlock()
 
-	// To get actual value, interface{} needs to be casted to cacheItem
-	cacheItemElement := item.Value.(cacheItem)
-	filename := cacheItemElement.value
+		l.removeFiles(cacheItemElement)
+		atomic.AddUint64(&l.stats.Misses, 1)
 
-	// Reading from filesystem
-	value, err := l.readFromFileSystem(filename)
-	if err != nil {
-		return []byte{}, fmt.Errorf("%w: %s", ErrFileRead, err)
+		return cacheItem{}, ErrItemNotExists
 	}
 
-	return value, nil
+	// If cache element exists, let the policy know about the hit
+	l.policy.Access(key)
+
+	l.mutex.Unlock()
+
+	return cacheItemElement, nil
+}
+
+// item returns metadata of the element as an item without value.
+func (c cacheItem) item() *Item {
+	return &Item{
+		Hash:       c.hash,
+		ModTime:    c.modTime,
+		ExpiresAt:  c.expiresAt,
+		FreshUntil: c.freshUntil,
+		Source:     c.source,
+	}
 }
 
 // Set is a LruCache setter: sets or updates value, depends on whether the value exists or not.
-func (l *LruCache) Set(key string, imageBytes []byte) error {
+// The file is written before the index is updated, so the index never points to a file being written.
+// Every version of the value has its own file, so readers of the previous one never see the new content.
+func (l *LruCache) Set(key string, item *Item) error {
+	filename := encodeFileName(key, item.Hash)
+	cacheItemElement := cacheItem{
+		key, filename, item.Hash, int64(len(item.Value)), item.ModTime, item.ExpiresAt, item.FreshUntil, item.Source,
+	}
+
+	// Saving file to filesystem, the stored hash must always describe the file content
+	err := l.saveToFileSystem(filename, key, item)
+	if err != nil {
+		l.logger.Error(fmt.Errorf("%w: %s", ErrFileWrite, err))
+		return nil
+	}
+
 	l.mutex.Lock()
-	defer l.mutex.Unlock()
+	evicted := l.add(cacheItemElement)
+	l.mutex.Unlock()
 
-	listItem, exists := l.items[key]
+	// Removing evicted files from filesystem
+	l.removeFiles(evicted...)
 
-	filename := encodeFileName(key)
-	cacheItemElement := cacheItem{key, filename}
+	return nil
+}
 
-	if exists {
-		// If cache element exists, move it to front
-		listItem.Value = cacheItemElement
-		l.queue.MoveToFront(listItem)
+// add puts element to the index, returning elements evicted by the policy, including
+// the element itself if the policy refused to admit it.
+func (l *LruCache) add(element cacheItem) []cacheItem {
+	if current, exists := l.items[element.key]; exists {
+		// If cache element exists, replace it, the file of the previous version is removed unless it is the same
+		l.size += element.size - current.size
+		l.items[element.key] = element
+		l.sources.remove(current.source, current.key)
+		l.sources.add(element.source, element.key)
+		l.policy.Access(element.key)
+
+		if current.value != element.value {
+			return []cacheItem{current}
+		}
+
+		return nil
+	}
+
+	admitted, evictedKeys := l.policy.Add(element.key)
+
+	evicted := make([]cacheItem, 0, len(evictedKeys)+1)
+	if !admitted {
+		evicted = append(evicted, element)
 	} else {
-		// If cache element doesn't exist, create
-		listItem = l.queue.PushFront(cacheItemElement)
+		l.items[element.key] = element
+		l.sources.add(element.source, element.key)
+		l.size += element.size
+	}
 
-		// If list exceeds capacity, remove last element from list and map
-		if int64(l.queue.Len()) > l.capacity {
-			l.removeLastRecentUsedElement()
+	for _, key := range evictedKeys {
+		// The policy may evict the element it has just admitted, e.g. when capacity is zero.
+		if key == element.key {
+			if admitted {
+				evicted = append(evicted, l.forget(key))
+			}
+			continue
 		}
 
-		// Saving file to filesystem
-		err := l.saveToFileSystem(filename, imageBytes)
-		if err != nil {
-			l.logger.Error(fmt.Errorf("%w: %s", ErrFileWrite, err))
-		}
+		atomic.AddUint64(&l.stats.Evictions, 1)
+		evicted = append(evicted, l.forget(key))
 	}
 
-	// Update map value anyway
-	l.items[key] = listItem
+	return evicted
+}
 
-	return nil
+// unlink removes element from policy and index.
+func (l *LruCache) unlink(key string) cacheItem {
+	l.policy.Remove(key)
+
+	return l.forget(key)
 }
 
-// removeLastRecentUsedElement removes LRU element from queue and file from filesystem.
-func (l *LruCache) removeLastRecentUsedElement() {
-	if item := l.queue.Back(); item != nil {
-		backCacheItem := item.Value.(cacheItem)
-		filename := backCacheItem.value
+// forget removes element from index only, it is used for keys evicted by the policy, which
+// has forgotten them already or keeps them as ghosts, such as ARC does.
+func (l *LruCache) forget(key string) cacheItem {
+	element := l.items[key]
 
-		delete(l.items, backCacheItem.key)
-		l.queue.Remove(item)
+	delete(l.items, key)
+	l.sources.remove(element.source, key)
+	l.size -= element.size
+
+	return element
+}
 
-		// Removing expired file from filesystem.
-		err := l.removeFromFileSystem(filename)
-		if err != nil {
+// removeFiles removes files of the elements from filesystem.
+func (l *LruCache) removeFiles(elements ...cacheItem) {
+	for _, element := range elements {
+		if err := l.removeFromFileSystem(element.value); err != nil {
 			l.logger.Error(fmt.Errorf("%w: %s", ErrFileRemove, err))
 		}
 	}
 }
 
-// encodeFileName generates filename from key.
-func encodeFileName(key string) string {
-	return base64.StdEncoding.EncodeToString([]byte(key))
+// evictIfUnchanged evicts an element which file turned out to be broken. If the element has been
+// evicted or replaced while its file was being read, the failure is caused by that and nothing is done.
+func (l *LruCache) evictIfUnchanged(element cacheItem, cause error) {
+	l.mutex.Lock()
+
+	current, exists := l.items[element.key]
+	if !exists || current != element {
+		l.mutex.Unlock()
+		return
+	}
+
+	l.unlink(element.key)
+	l.mutex.Unlock()
+
+	l.logger.Warn(fmt.Errorf("%w: %s", ErrFileRead, cause))
+	l.removeFiles(element)
+}
+
+// verify checks that value matches the length and checksum it was stored with.
+func verify(value []byte, size int64, hash string) error {
+	if int64(len(value)) != size {
+		return fmt.Errorf("%w: expected %d bytes, %d given", ErrItemCorrupted, size, len(value))
+	}
+
+	sum := sha256.Sum256(value)
+	if hex.EncodeToString(sum[:]) != hash {
+		return fmt.Errorf("%w: checksum mismatch", ErrItemCorrupted)
+	}
+
+	return nil
 }
 
-// saveToFileSystem writes file to filesystem.
-func (l *LruCache) saveToFileSystem(filename string, bytes []byte) error {
+// encodeFileName generates filename from key: a hash sharded into two levels of subdirectories,
+// so that it is filesystem-safe and directories don't grow too large. The name is suffixed with
+// the beginning of the content hash, so that every version of the value is a distinct file.
+func encodeFileName(key, hash string) string {
+	name := hashKey(key)
+	if len(hash) > versionLength {
+		hash = hash[:versionLength]
+	}
+
+	return filepath.Join(name[0:2], name[2:4], name+"-"+hash)
+}
+
+// saveToFileSystem writes file and its sidecar to filesystem.
+func (l *LruCache) saveToFileSystem(filename, key string, item *Item) error {
 	absFilename := filepath.Join(l.path, filename)
-	return ioutil.WriteFile(absFilename, bytes, 0o600)
+	if err := os.MkdirAll(filepath.Dir(absFilename), os.ModePerm); err != nil {
+		return err
+	}
+
+	// The sidecar is written last: a file without one is incomplete and gets removed on restore.
+	if err := writeFileAtomic(absFilename, item.Value); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(fileMeta{
+		key, item.Hash, int64(len(item.Value)), item.ModTime, item.ExpiresAt, item.FreshUntil, item.Source,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(absFilename+metaSuffix, meta)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it, so that readers never see partial files.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), tmpPrefix)
+	if err != nil {
+		return err
+	}
+
+	// Removing the temporary file if anything goes wrong, it is a no-op after rename.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
 }
 
 // reads file from filesystem.
@@ -164,16 +522,138 @@ func (l *LruCache) readFromFileSystem(filename string) ([]byte, error) {
 	return bytes, nil
 }
 
-// removeFromFileSystem removes file from filesystem.
+// removeFromFileSystem removes file and its sidecar from filesystem.
 func (l *LruCache) removeFromFileSystem(filename string) error {
 	absFilename := filepath.Join(l.path, filename)
-	err := os.Remove(absFilename)
+	if err := os.Remove(absFilename + metaSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 
-	return err
+	return os.Remove(absFilename)
 }
 
 // Clear re-init lruCache instance.
 func (l *LruCache) Clear() {
-	l.queue = NewList()
-	l.items = make(map[string]*ListItem, l.capacity)
+	l.mutex.Lock()
+
+	elements := make([]cacheItem, 0, len(l.items))
+	for _, element := range l.items {
+		elements = append(elements, element)
+	}
+
+	// Policy name has been validated by the constructor.
+	l.policy, _ = NewPolicy(l.policyName, int(l.capacity))
+	l.items = make(map[string]cacheItem, l.capacity)
+	l.sources = make(sourceIndex)
+	l.size = 0
+
+	l.mutex.Unlock()
+
+	l.removeFiles(elements...)
+}
+
+// Delete removes the item and its files, reporting whether it has existed.
+func (l *LruCache) Delete(key string) bool {
+	l.mutex.Lock()
+	_, exists := l.items[key]
+	if !exists {
+		l.mutex.Unlock()
+		return false
+	}
+
+	element := l.unlink(key)
+	l.mutex.Unlock()
+
+	l.removeFiles(element)
+
+	return true
+}
+
+// DeleteFunc removes items, which keys match, returning count of removed items.
+func (l *LruCache) DeleteFunc(match func(key string) bool) int {
+	deleted := make([]cacheItem, 0)
+
+	l.mutex.Lock()
+	for key := range l.items {
+		if match(key) {
+			deleted = append(deleted, l.unlink(key))
+		}
+	}
+	l.mutex.Unlock()
+
+	l.removeFiles(deleted...)
+
+	return len(deleted)
+}
+
+// Variants returns keys of items derived from the source.
+func (l *LruCache) Variants(source string) []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.sources.keys(source)
+}
+
+// DeleteVariants removes items derived from the source along with their files, returning count of removed items.
+func (l *LruCache) DeleteVariants(source string) int {
+	l.mutex.Lock()
+
+	keys := l.sources.keys(source)
+	deleted := make([]cacheItem, 0, len(keys))
+
+	for _, key := range keys {
+		deleted = append(deleted, l.unlink(key))
+	}
+
+	l.mutex.Unlock()
+
+	l.removeFiles(deleted...)
+
+	return len(deleted)
+}
+
+// Entries returns descriptions of all items.
+func (l *LruCache) Entries() []Entry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entries := make([]Entry, 0, len(l.items))
+	for _, element := range l.items {
+		entries = append(entries, Entry{element.key, element.size, element.hash, element.modTime, element.expiresAt, element.source})
+	}
+
+	return entries
+}
+
+// RemoveExpired removes expired items and their files, returning count of removed items.
+func (l *LruCache) RemoveExpired() int {
+	now := time.Now()
+	expired := make([]cacheItem, 0)
+
+	l.mutex.Lock()
+	for key, element := range l.items {
+		if isExpired(element.expiresAt, now) {
+			expired = append(expired, l.unlink(key))
+		}
+	}
+	l.mutex.Unlock()
+
+	l.removeFiles(expired...)
+
+	return len(expired)
+}
+
+// Stats returns a snapshot of cache counters.
+func (l *LruCache) Stats() Stats {
+	l.mutex.Lock()
+	items, size := int64(len(l.items)), l.size
+	l.mutex.Unlock()
+
+	return Stats{
+		Items:     items,
+		Bytes:     size,
+		Hits:      atomic.LoadUint64(&l.stats.Hits),
+		Misses:    atomic.LoadUint64(&l.stats.Misses),
+		Evictions: atomic.LoadUint64(&l.stats.Evictions),
+	}
 }
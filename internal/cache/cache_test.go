@@ -4,63 +4,283 @@ import (
 	"errors"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	internalconfig "github.com/spendmail/previewer/internal/config"
 	internallogger "github.com/spendmail/previewer/internal/logger"
 	"github.com/stretchr/testify/require"
 )
 
-func TestCache(t *testing.T) {
-	t.Run("empty cache", func(t *testing.T) {
-		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
-		if err != nil {
-			t.Fatal(err)
-		}
+// backends lists constructors of every cache backend, the common suite runs against each of them.
+var backends = map[string]func(t *testing.T, config *internalconfig.Config) Cache{
+	BackendFilesystem: func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
+		config.Cache.Backend = BackendFilesystem
+		config.Cache.MemoryBytes = 0
 
-		logger, err := internallogger.New(config)
-		if err != nil {
-			t.Fatal(err)
-		}
+		return newTestCache(t, config)
+	},
+	"sharded": func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
+		config.Cache.Backend = BackendFilesystem
+		config.Cache.MemoryBytes = 0
+		config.Cache.Shards = 4
 
-		c, err := New(config, logger)
-		if err != nil {
-			t.Fatal(err)
-		}
+		return newTestCache(t, config)
+	},
+	PolicyTinyLFU: func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
+		config.Cache.Backend = BackendFilesystem
+		config.Cache.MemoryBytes = 0
+		config.Cache.Policy = PolicyTinyLFU
 
-		_, err = c.Get("aaa")
-		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		return newTestCache(t, config)
+	},
+	PolicyARC: func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
+		config.Cache.Backend = BackendFilesystem
+		config.Cache.MemoryBytes = 0
+		config.Cache.Policy = PolicyARC
 
-		_, err = c.Get("bbb")
-		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
-	})
+		return newTestCache(t, config)
+	},
+	"tiered": func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
+		config.Cache.Backend = BackendFilesystem
 
-	t.Run("cache capacity", func(t *testing.T) {
-		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
-		if err != nil {
-			t.Fatal(err)
-		}
+		return newTestCache(t, config)
+	},
+	BackendMemory: func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
+		config.Cache.Backend = BackendMemory
 
-		config.Cache.Capacity = 2
+		return newTestCache(t, config)
+	},
+	BackendS3: func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
 
 		logger, err := internallogger.New(config)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		c, err := New(config, logger)
-		if err != nil {
-			t.Fatal(err)
-		}
+		return NewS3CacheWithClient(newFakeS3(), config.GetCacheS3Bucket(), config.GetCacheS3Prefix(), logger)
+	},
+	BackendRedis: func(t *testing.T, config *internalconfig.Config) Cache {
+		t.Helper()
+		config.Cache.Backend = BackendRedis
+		config.Cache.MemoryBytes = 0
+		config.Cache.Redis.Address = miniredis.RunT(t).Addr()
+
+		return newTestCache(t, config)
+	},
+}
+
+func newTestConfig(t *testing.T) *internalconfig.Config {
+	t.Helper()
+
+	config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Filesystem cache restores its index on start, so every test needs a clean directory.
+	config.Cache.Path = t.TempDir()
+
+	return config
+}
+
+func newTestLogger(t *testing.T) Logger {
+	t.Helper()
+
+	logger, err := internallogger.New(newTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return logger
+}
+
+func newTestCache(t *testing.T, config *internalconfig.Config) Cache {
+	t.Helper()
+
+	c, err := New(config, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestCache(t *testing.T) {
+	for name, newBackend := range backends {
+		newBackend := newBackend
+
+		t.Run(name, func(t *testing.T) {
+			t.Run("empty cache", func(t *testing.T) {
+				c := newBackend(t, newTestConfig(t))
+
+				_, err := c.Get("aaa")
+				require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+				_, err = c.Get("bbb")
+				require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+			})
+
+			t.Run("item metadata", func(t *testing.T) {
+				c := newBackend(t, newTestConfig(t))
+
+				item := NewItem([]byte("aaa"))
+				require.Equal(t, "9834876dcfb05cb167a5c24953eba58c4ac89b1adf57f28f2f9d09af107ee8f0", item.Hash)
+
+				err := c.Set("aaa", item)
+				require.NoError(t, err)
+
+				val, err := c.Get("aaa")
+				require.NoError(t, err)
+				require.Equal(t, []byte("aaa"), val.Value)
+				require.Equal(t, item.Hash, val.Hash)
+				require.True(t, item.ModTime.Equal(val.ModTime))
+
+				err = c.Set("aaa", NewItem([]byte("bbb")))
+				require.NoError(t, err)
+
+				val, err = c.Get("aaa")
+				require.NoError(t, err)
+				require.Equal(t, []byte("bbb"), val.Value)
+				require.NotEqual(t, item.Hash, val.Hash)
+			})
+
+			t.Run("clear", func(t *testing.T) {
+				c := newBackend(t, newTestConfig(t))
+
+				err := c.Set("aaa", NewItem([]byte("aaa")))
+				require.NoError(t, err)
+
+				c.Clear()
+
+				_, err = c.Get("aaa")
+				require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+			})
+
+			t.Run("expiration", func(t *testing.T) {
+				c := newBackend(t, newTestConfig(t))
+
+				expired := NewItem([]byte("aaa"))
+				expired.ExpiresAt = expired.ModTime.Add(-time.Second)
+
+				err := c.Set("aaa", expired)
+				require.NoError(t, err)
+
+				_, err = c.Get("aaa")
+				require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+				stale := NewItem([]byte("bbb"))
+				stale.FreshUntil = stale.ModTime.Add(-time.Second)
+				stale.ExpiresAt = stale.ModTime.Add(time.Hour)
+
+				err = c.Set("bbb", stale)
+				require.NoError(t, err)
+
+				// Stale items are kept until they expire.
+				val, err := c.Get("bbb")
+				require.NoError(t, err)
+				require.True(t, stale.ExpiresAt.Equal(val.ExpiresAt))
+				require.True(t, stale.FreshUntil.Equal(val.FreshUntil))
+				require.False(t, val.Fresh(time.Now()))
+			})
+
+			t.Run("admin", func(t *testing.T) {
+				c := newBackend(t, newTestConfig(t))
+				admin, ok := c.(Admin)
+				if !ok {
+					t.Skip("backend doesn't support management")
+				}
+
+				for _, key := range []string{"aaa", "aab", "bbb"} {
+					require.NoError(t, c.Set(key, NewItem([]byte(key))))
+				}
+
+				// Redis doesn't count its items, as that would require scanning the keyspace.
+				if _, ok := c.(*RedisCache); !ok {
+					require.Equal(t, int64(3), admin.Stats().Items)
+					require.Equal(t, int64(9), admin.Stats().Bytes)
+				}
+				require.Len(t, admin.Entries(), 3)
+
+				deleted := admin.DeleteFunc(func(key string) bool {
+					return key[:2] == "aa"
+				})
+				require.Equal(t, 2, deleted)
+
+				entries := admin.Entries()
+				require.Len(t, entries, 1)
+				require.Equal(t, "bbb", entries[0].Key)
+				require.Equal(t, int64(3), entries[0].Size)
+
+				require.True(t, admin.Delete("bbb"))
+				require.False(t, admin.Delete("bbb"))
 
-		err = c.Set("aaa", []byte("aaa"))
+				_, err := c.Get("bbb")
+				require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+				require.Empty(t, admin.Entries())
+			})
+
+			t.Run("source index", func(t *testing.T) {
+				c := newBackend(t, newTestConfig(t))
+				indexer, ok := c.(SourceIndexer)
+				if !ok {
+					t.Skip("backend doesn't index sources")
+				}
+
+				for _, key := range []string{"a.jpg-1-1", "a.jpg-2-2", "b.jpg-1-1"} {
+					item := NewItem([]byte(key))
+					item.Source = key[:5]
+					require.NoError(t, c.Set(key, item))
+				}
+
+				val, err := c.Get("a.jpg-1-1")
+				require.NoError(t, err)
+				require.Equal(t, "a.jpg", val.Source)
+
+				require.ElementsMatch(t, []string{"a.jpg-1-1", "a.jpg-2-2"}, indexer.Variants("a.jpg"))
+				require.Equal(t, 2, indexer.DeleteVariants("a.jpg"))
+				require.Empty(t, indexer.Variants("a.jpg"))
+
+				_, err = c.Get("a.jpg-2-2")
+				require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+				_, err = c.Get("b.jpg-1-1")
+				require.NoError(t, err)
+			})
+
+			t.Run("multithreading", func(t *testing.T) {
+				config := newTestConfig(t)
+				config.Cache.Capacity = 2
+				config.Cache.MemoryBytes = 8
+
+				testCacheMultithreading(t, newBackend(t, config))
+			})
+		})
+	}
+
+	t.Run("cache capacity", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.Capacity = 2
+
+		c := backends[BackendFilesystem](t, config)
+
+		err := c.Set("aaa", NewItem([]byte("aaa")))
 		require.NoError(t, err)
 
-		err = c.Set("bbb", []byte("bbb"))
+		err = c.Set("bbb", NewItem([]byte("bbb")))
 		require.NoError(t, err)
 
-		err = c.Set("ccc", []byte("ccc"))
+		err = c.Set("ccc", NewItem([]byte("ccc")))
 		require.NoError(t, err)
 
 		_, err = c.Get("aaa")
@@ -68,31 +288,58 @@ func TestCache(t *testing.T) {
 
 		val, err := c.Get("bbb")
 		require.NoError(t, err)
-		require.Equal(t, []byte("bbb"), val)
+		require.Equal(t, []byte("bbb"), val.Value)
 
 		val, err = c.Get("ccc")
 		require.NoError(t, err)
-		require.Equal(t, []byte("ccc"), val)
+		require.Equal(t, []byte("ccc"), val.Value)
+
+		err = c.Set("ddd", NewItem([]byte("ddd")))
+		require.NoError(t, err)
+
+		_, err = c.Get("bbb")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
 	})
-}
 
-func TestCacheMultithreading(t *testing.T) {
-	config, err := internalconfig.NewConfig("../../configs/previewer.toml")
-	if err != nil {
-		t.Fatal(err)
-	}
+	t.Run("memory byte budget", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 6
 
-	config.Cache.Capacity = 2
+		c := backends[BackendMemory](t, config)
 
-	logger, err := internallogger.New(config)
-	if err != nil {
-		t.Fatal(err)
-	}
+		err := c.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
 
-	c, err := New(config, logger)
-	if err != nil {
-		t.Fatal(err)
-	}
+		err = c.Set("bbb", NewItem([]byte("bbb")))
+		require.NoError(t, err)
+
+		// Touching "aaa" makes "bbb" the least recently used item.
+		_, err = c.Get("aaa")
+		require.NoError(t, err)
+
+		err = c.Set("cc", NewItem([]byte("cc")))
+		require.NoError(t, err)
+
+		_, err = c.Get("bbb")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		_, err = c.Get("aaa")
+		require.NoError(t, err)
+
+		// Values exceeding the whole budget are not stored.
+		err = c.Set("large", NewItem([]byte("larger than budget")))
+		require.NoError(t, err)
+
+		_, err = c.Get("large")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		_, err = c.Get("aaa")
+		require.NoError(t, err)
+	})
+}
+
+func testCacheMultithreading(t *testing.T, c Cache) {
+	t.Helper()
 
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
@@ -101,7 +348,7 @@ func TestCacheMultithreading(t *testing.T) {
 		defer wg.Done()
 		for i := 0; i < 1_000; i++ {
 			key := strconv.Itoa(i)
-			_ = c.Set(key, []byte(key))
+			_ = c.Set(key, NewItem([]byte(key)))
 		}
 	}()
 
@@ -115,3 +362,86 @@ func TestCacheMultithreading(t *testing.T) {
 
 	wg.Wait()
 }
+
+// TestLruCacheStress is meant to be run with -race: readers and writers hammer a small cache,
+// so that entries get evicted and replaced while their files are being read.
+func TestLruCacheStress(t *testing.T) {
+	config := newTestConfig(t)
+	config.Cache.Capacity = 8
+
+	c := backends[BackendFilesystem](t, config)
+
+	wg := &sync.WaitGroup{}
+
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := strconv.Itoa(rand.Intn(32))
+				_ = c.Set(key, NewItem([]byte(key)))
+			}
+		}()
+	}
+
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := strconv.Itoa(rand.Intn(32))
+
+				// A hit must always return the value stored under the key.
+				val, err := c.Get(key)
+				if err == nil && string(val.Value) != key {
+					t.Errorf("value %q given for key %q", val.Value, key)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// TestLruCacheOverwrite is meant to be run with -race: a key is overwritten with different values while
+// being read, readers must neither see the new content under the previous metadata nor lose the new value.
+func TestLruCacheOverwrite(t *testing.T) {
+	c := backends[BackendFilesystem](t, newTestConfig(t))
+
+	for i := 0; i < 200; i++ {
+		value := []byte(strings.Repeat(strconv.Itoa(i), 1024))
+		stop := make(chan struct{})
+		wg := &sync.WaitGroup{}
+
+		for r := 0; r < 4; r++ {
+			started := make(chan struct{})
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; ; n++ {
+					if n == 1 {
+						close(started)
+					}
+
+					select {
+					case <-stop:
+						return
+					default:
+						_, _ = c.Get("aaa")
+					}
+				}
+			}()
+
+			<-started
+		}
+
+		require.NoError(t, c.Set("aaa", NewItem(value)))
+		close(stop)
+		wg.Wait()
+
+		val, err := c.Get("aaa")
+		require.NoError(t, err, "round %d", i)
+		require.Equal(t, value, val.Value)
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var ErrCacheCheck = errors.New("cache is unavailable")
+
+// Checker is implemented by caches, which are able to tell whether items can be stored.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Check makes sure the cache directory is writable.
+func (l *LruCache) Check(ctx context.Context) error {
+	// Temporary files are removed on restart, should this one be left over.
+	file, err := os.CreateTemp(l.path, tmpPrefix+"check-")
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCacheCheck, err)
+	}
+
+	_, err = file.Write([]byte{0})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if removeErr := os.Remove(file.Name()); err == nil {
+		err = removeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCacheCheck, err)
+	}
+
+	return nil
+}
+
+// Check makes sure directories of every shard are writable.
+func (s *ShardedCache) Check(ctx context.Context) error {
+	for _, shard := range s.shards {
+		if err := shard.Check(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check checks L2, the memory cache is always available.
+func (t *TieredCache) Check(ctx context.Context) error {
+	if checker, ok := t.l2.(Checker); ok {
+		return checker.Check(ctx)
+	}
+
+	return nil
+}
+
+// Check pings the server.
+func (r *RedisCache) Check(ctx context.Context) error {
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%w: %s", ErrCacheCheck, err)
+	}
+
+	return nil
+}
+
+// Check makes sure objects of the bucket can be listed.
+func (s *S3Cache) Check(ctx context.Context) error {
+	_, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(s.prefix),
+		MaxKeys: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrCacheCheck, err)
+	}
+
+	return nil
+}
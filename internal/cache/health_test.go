@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	t.Run("available backends", func(t *testing.T) {
+		for name, newBackend := range backends {
+			c, ok := newBackend(t, newTestConfig(t)).(Checker)
+			if name == BackendMemory {
+				require.False(t, ok, "memory cache is always available")
+				continue
+			}
+
+			require.Truef(t, ok, "%s cache must be checked", name)
+			require.NoErrorf(t, c.Check(context.Background()), "%s cache", name)
+		}
+	})
+
+	t.Run("leftovers", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.Backend = BackendFilesystem
+		config.Cache.MemoryBytes = 0
+
+		c := newTestCache(t, config).(Checker)
+		require.NoError(t, c.Check(context.Background()))
+
+		entries, err := os.ReadDir(config.Cache.Path)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("unwritable directory", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.Backend = BackendFilesystem
+
+		c := newTestCache(t, config).(Checker)
+		require.NoError(t, os.RemoveAll(config.Cache.Path))
+
+		err := c.Check(context.Background())
+		require.Truef(t, errors.Is(err, ErrCacheCheck), "actual error %q", err)
+	})
+
+	t.Run("unreachable redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+
+		config := newTestConfig(t)
+		config.Cache.Backend = BackendRedis
+		config.Cache.MemoryBytes = 0
+		config.Cache.Redis.Address = server.Addr()
+
+		c := newTestCache(t, config).(Checker)
+		require.NoError(t, c.Check(context.Background()))
+
+		server.Close()
+
+		err := c.Check(context.Background())
+		require.Truef(t, errors.Is(err, ErrCacheCheck), "actual error %q", err)
+	})
+}
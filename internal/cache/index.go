@@ -0,0 +1,64 @@
+package cache
+
+// SourceIndexer is implemented by backends, which index items by the source they are derived from,
+// so that every variant of one source can be found without scanning the whole cache.
+type SourceIndexer interface {
+	Variants(source string) []string
+	DeleteVariants(source string) int
+}
+
+// SourceIndexerOf returns the source index of the cache, if it maintains one. A tiered cache
+// maintains one only if its L2 does, for the same reason as with AdminOf.
+func SourceIndexerOf(c Cache) (SourceIndexer, bool) {
+	if tiered, ok := c.(*TieredCache); ok {
+		if _, ok := tiered.l2.(SourceIndexer); !ok {
+			return nil, false
+		}
+	}
+
+	indexer, ok := c.(SourceIndexer)
+
+	return indexer, ok
+}
+
+// sourceIndex maps sources to keys of their variants, it is guarded by the owner's mutex.
+type sourceIndex map[string]map[string]struct{}
+
+// add links the key to the source, items without source are not indexed.
+func (s sourceIndex) add(source, key string) {
+	if source == "" {
+		return
+	}
+
+	keys, exists := s[source]
+	if !exists {
+		keys = make(map[string]struct{})
+		s[source] = keys
+	}
+
+	keys[key] = struct{}{}
+}
+
+// remove unlinks the key from the source, forgetting sources without variants.
+func (s sourceIndex) remove(source, key string) {
+	keys, exists := s[source]
+	if !exists {
+		return
+	}
+
+	delete(keys, key)
+
+	if len(keys) == 0 {
+		delete(s, source)
+	}
+}
+
+// keys returns keys of the source variants.
+func (s sourceIndex) keys(source string) []string {
+	keys := make([]string, 0, len(s[source]))
+	for key := range s[source] {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Expirer is implemented by backends, which have to remove expired items by themselves.
+type Expirer interface {
+	RemoveExpired() int
+}
+
+// Janitor periodically removes expired items, so that they don't occupy space until being accessed.
+type Janitor struct {
+	interval time.Duration
+	cache    Cache
+	logger   Logger
+}
+
+// NewJanitor is a janitor constructor.
+func NewJanitor(config Config, logger Logger, cache Cache) *Janitor {
+	return &Janitor{
+		interval: config.GetCacheJanitorInterval(),
+		cache:    cache,
+		logger:   logger,
+	}
+}
+
+// Run removes expired items every interval until the context is done.
+// It returns immediately if disabled or if the backend expires items by itself.
+func (j *Janitor) Run(ctx context.Context) {
+	expirer, ok := j.cache.(Expirer)
+	if !ok || j.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := expirer.RemoveExpired(); removed > 0 {
+				j.logger.Debug("removed ", removed, " expired cache items")
+			}
+		}
+	}
+}
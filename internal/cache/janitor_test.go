@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJanitor(t *testing.T) {
+	t.Run("removes expired items", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+		config.Cache.JanitorInterval = 10 * time.Millisecond
+
+		c := newTestCache(t, config)
+
+		expired := NewItem([]byte("aaa"))
+		expired.ExpiresAt = time.Now().Add(-time.Second)
+		require.NoError(t, c.Set("aaa", expired))
+		require.NoError(t, c.Set("bbb", NewItem([]byte("bbb"))))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			NewJanitor(config, newTestLogger(t), c).Run(ctx)
+			close(done)
+		}()
+
+		// Expired item is removed along with its file without being accessed.
+		filename := filepath.Join(config.GetCachePath(), encodeFileName("aaa", NewItem([]byte("aaa")).Hash))
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(filename)
+			return os.IsNotExist(err)
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, int64(1), c.(*LruCache).Stats().Items)
+
+		val, err := c.Get("bbb")
+		require.NoError(t, err)
+		require.Equal(t, []byte("bbb"), val.Value)
+
+		cancel()
+		<-done
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.JanitorInterval = 0
+
+		// Run returns immediately, without waiting for the context.
+		NewJanitor(config, newTestLogger(t), newTestCache(t, config)).Run(context.Background())
+	})
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// keySeparator separates the source from transformation options, it never occurs in escaped sources.
+	keySeparator = "#"
+
+	keyMode    = "m"
+	keyWidth   = "w"
+	keyHeight  = "h"
+	keyFormat  = "fmt"
+	keyQuality = "q"
+	keyFilters = "f"
+)
+
+var ErrKeyParse = errors.New("unable to parse cache key")
+
+// TransformKey identifies a rendered variant: the source it is derived from and every option
+// of the transformation. Zero values are omitted from the canonical form, so that adding
+// a new option doesn't change keys of variants, which don't use it.
+type TransformKey struct {
+	Source  string
+	Mode    string
+	Width   int
+	Height  int
+	Format  string
+	Quality int
+	// Filters are applied in order, so their order is a part of the key.
+	Filters []string
+}
+
+// String returns the canonical serialization: the escaped source followed by sorted options,
+// e.g. "example.com/image.jpg#h=200&m=fill&w=300". The source goes first, so that keys of
+// one source share a prefix.
+func (k TransformKey) String() string {
+	options := url.Values{}
+
+	if k.Mode != "" {
+		options.Set(keyMode, k.Mode)
+	}
+
+	if k.Width != 0 {
+		options.Set(keyWidth, strconv.Itoa(k.Width))
+	}
+
+	if k.Height != 0 {
+		options.Set(keyHeight, strconv.Itoa(k.Height))
+	}
+
+	if k.Format != "" {
+		options.Set(keyFormat, k.Format)
+	}
+
+	if k.Quality != 0 {
+		options.Set(keyQuality, strconv.Itoa(k.Quality))
+	}
+
+	if len(k.Filters) > 0 {
+		filters := make([]string, 0, len(k.Filters))
+		for _, filter := range k.Filters {
+			filters = append(filters, url.QueryEscape(filter))
+		}
+
+		options.Set(keyFilters, strings.Join(filters, ","))
+	}
+
+	// Values.Encode sorts options by name.
+	return escapeSource(k.Source) + keySeparator + options.Encode()
+}
+
+// ParseTransformKey restores a key from its canonical serialization.
+func ParseTransformKey(s string) (TransformKey, error) {
+	i := strings.Index(s, keySeparator)
+	if i < 0 {
+		return TransformKey{}, fmt.Errorf("%w: %s", ErrKeyParse, s)
+	}
+
+	source, err := url.PathUnescape(s[:i])
+	if err != nil {
+		return TransformKey{}, fmt.Errorf("%w: %s", ErrKeyParse, err)
+	}
+
+	options, err := url.ParseQuery(s[i+1:])
+	if err != nil {
+		return TransformKey{}, fmt.Errorf("%w: %s", ErrKeyParse, err)
+	}
+
+	key := TransformKey{
+		Source: source,
+		Mode:   options.Get(keyMode),
+		Format: options.Get(keyFormat),
+	}
+
+	for name, value := range map[string]*int{keyWidth: &key.Width, keyHeight: &key.Height, keyQuality: &key.Quality} {
+		if options.Get(name) == "" {
+			continue
+		}
+
+		if *value, err = strconv.Atoi(options.Get(name)); err != nil {
+			return TransformKey{}, fmt.Errorf("%w: %s", ErrKeyParse, err)
+		}
+	}
+
+	if filters := options.Get(keyFilters); filters != "" {
+		for _, filter := range strings.Split(filters, ",") {
+			unescaped, err := url.QueryUnescape(filter)
+			if err != nil {
+				return TransformKey{}, fmt.Errorf("%w: %s", ErrKeyParse, err)
+			}
+
+			key.Filters = append(key.Filters, unescaped)
+		}
+	}
+
+	return key, nil
+}
+
+// SourcePrefix returns the prefix shared by keys of every source starting with the given one.
+func SourcePrefix(source string) string {
+	return escapeSource(source)
+}
+
+// escapeSource escapes the separator and the escape character only, keeping URLs readable.
+func escapeSource(source string) string {
+	return strings.NewReplacer("%", "%25", keySeparator, "%23").Replace(source)
+}
+
+// hashKey returns hex-encoded sha256 of the key.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
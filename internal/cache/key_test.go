@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformKey(t *testing.T) {
+	t.Run("canonical serialization", func(t *testing.T) {
+		key := TransformKey{Source: "example.com/image.jpg", Mode: "fill", Width: 300, Height: 200}
+		require.Equal(t, "example.com/image.jpg#h=200&m=fill&w=300", key.String())
+
+		// Zero options are omitted, so that new options don't change existing keys.
+		require.Equal(t, "example.com/image.jpg#", TransformKey{Source: "example.com/image.jpg"}.String())
+	})
+
+	t.Run("no collisions", func(t *testing.T) {
+		keys := []TransformKey{
+			{Source: "example.com/image-10", Width: 1, Height: 2},
+			{Source: "example.com/image", Width: 10, Height: 1},
+			{Source: "example.com/image#w=1", Height: 2},
+			{Source: "example.com/image", Width: 1, Height: 2, Filters: []string{"blur,2"}},
+			{Source: "example.com/image", Width: 1, Height: 2, Filters: []string{"blur", "2"}},
+			{Source: "example.com/image", Width: 1, Height: 2, Filters: []string{"2", "blur"}},
+		}
+
+		seen := make(map[string]bool)
+		for _, key := range keys {
+			require.Falsef(t, seen[key.String()], "collision of %q", key.String())
+			seen[key.String()] = true
+		}
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		keys := []TransformKey{
+			{Source: "example.com/image.jpg", Mode: "fill", Width: 300, Height: 200},
+			{Source: "example.com/100%#?a=b&c", Format: "webp", Quality: 80, Filters: []string{"blur:2", "a,b&c"}},
+			{},
+		}
+
+		for _, key := range keys {
+			parsed, err := ParseTransformKey(key.String())
+			require.NoError(t, err)
+			require.Equal(t, key, parsed)
+		}
+
+		_, err := ParseTransformKey("example.com/image.jpg-300-200")
+		require.Truef(t, errors.Is(err, ErrKeyParse), "actual error %q", err)
+	})
+
+	t.Run("source prefix", func(t *testing.T) {
+		key := TransformKey{Source: "example.com/100%/image.jpg", Width: 1}
+		require.True(t, strings.HasPrefix(key.String(), SourcePrefix("example.com/100%/")))
+	})
+}
@@ -0,0 +1,100 @@
+package cache
+
+// LFUPolicy evicts the least frequently used key, the least recently used one among equals.
+// Keys are grouped into buckets of equal frequency, ordered from the lowest one, so that
+// every operation is O(1).
+type LFUPolicy struct {
+	capacity int
+	buckets  List
+	items    map[string]*ListItem
+}
+
+type lfuBucket struct {
+	frequency int
+	entries   List
+}
+
+type lfuEntry struct {
+	key    string
+	bucket *ListItem
+}
+
+// NewLFUPolicy is a LFU policy constructor.
+func NewLFUPolicy(capacity int) *LFUPolicy {
+	return &LFUPolicy{
+		capacity: capacity,
+		buckets:  NewList(),
+		items:    make(map[string]*ListItem, capacity),
+	}
+}
+
+// Access moves key to the bucket of the next frequency.
+func (p *LFUPolicy) Access(key string) {
+	item, exists := p.items[key]
+	if !exists {
+		return
+	}
+
+	entry := item.Value.(*lfuEntry)
+	current := entry.bucket
+	frequency := current.Value.(*lfuBucket).frequency
+
+	next := current.Next
+	if next == nil || next.Value.(*lfuBucket).frequency != frequency+1 {
+		next = p.buckets.InsertAfter(&lfuBucket{frequency + 1, NewList()}, current)
+	}
+
+	p.unlink(item)
+	entry.bucket = next
+	p.items[key] = next.Value.(*lfuBucket).entries.PushFront(entry)
+}
+
+// Add puts key to the bucket of frequency 1, evicting a key of the lowest frequency if needed.
+func (p *LFUPolicy) Add(key string) (bool, []string) {
+	var evicted []string
+
+	if p.capacity <= 0 {
+		return false, nil
+	}
+
+	if p.Len() >= p.capacity {
+		lowest := p.buckets.Front().Value.(*lfuBucket)
+		victim := lowest.entries.Back().Value.(*lfuEntry).key
+
+		p.Remove(victim)
+		evicted = append(evicted, victim)
+	}
+
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).frequency != 1 {
+		front = p.buckets.PushFront(&lfuBucket{1, NewList()})
+	}
+
+	p.items[key] = front.Value.(*lfuBucket).entries.PushFront(&lfuEntry{key, front})
+
+	return true, evicted
+}
+
+// Remove forgets a key.
+func (p *LFUPolicy) Remove(key string) {
+	if item, exists := p.items[key]; exists {
+		p.unlink(item)
+		delete(p.items, key)
+	}
+}
+
+// Len returns count of keys.
+func (p *LFUPolicy) Len() int {
+	return len(p.items)
+}
+
+// unlink removes entry from its bucket, removing the bucket once it is empty.
+func (p *LFUPolicy) unlink(item *ListItem) {
+	bucketItem := item.Value.(*lfuEntry).bucket
+	bucket := bucketItem.Value.(*lfuBucket)
+
+	bucket.entries.Remove(item)
+	if bucket.entries.Len() == 0 {
+		p.buckets.Remove(bucketItem)
+	}
+}
@@ -6,6 +6,7 @@ type List interface {
 	Back() *ListItem
 	PushFront(v interface{}) *ListItem
 	PushBack(v interface{}) *ListItem
+	InsertAfter(v interface{}, mark *ListItem) *ListItem
 	Remove(i *ListItem)
 	MoveToFront(i *ListItem)
 }
@@ -80,6 +81,21 @@ func (l *list) PushBack(v interface{}) *ListItem {
 	return l.back
 }
 
+// InsertAfter puts data to the ListItem right after the mark.
+func (l *list) InsertAfter(v interface{}, mark *ListItem) *ListItem {
+	// If mark is at the back, it is the same as pushing back
+	if mark == l.back {
+		return l.PushBack(v)
+	}
+
+	listItem := &ListItem{Value: v, Next: mark.Next, Prev: mark}
+	mark.Next.Prev = listItem
+	mark.Next = listItem
+	l.len++
+
+	return listItem
+}
+
 // Remove removes element from the list and adjusts appropriate pointers.
 func (l *list) Remove(i *ListItem) {
 	// If item is only one element
@@ -102,8 +118,8 @@ func (l *list) Remove(i *ListItem) {
 
 	// If item is back element
 	if i == l.back {
-		l.back.Prev = nil
-		l.back = nil
+		l.back = l.back.Prev
+		l.back.Next = nil
 		i = nil
 		l.len--
 		return
@@ -137,6 +153,8 @@ func (l *list) MoveToFront(i *ListItem) {
 	// If item is neither at the front nor back
 	i.Prev.Next = i.Next
 	i.Next.Prev = i.Prev
+	i.Prev = nil
 	i.Next = l.front
 	l.front.Prev = i
+	l.front = i
 }
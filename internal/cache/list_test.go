@@ -48,4 +48,57 @@ func TestList(t *testing.T) {
 		}
 		require.Equal(t, []int{70, 80, 60, 40, 10, 30, 50}, elems)
 	})
+
+	t.Run("remove back", func(t *testing.T) {
+		l := NewList()
+
+		l.PushBack(10) // [10]
+		l.PushBack(20) // [10, 20]
+		l.PushBack(30) // [10, 20, 30]
+
+		l.Remove(l.Back()) // [10, 20]
+		require.Equal(t, 2, l.Len())
+		require.Equal(t, 20, l.Back().Value)
+		require.Nil(t, l.Back().Next)
+
+		l.Remove(l.Back()) // [10]
+		require.Equal(t, 1, l.Len())
+		require.Equal(t, 10, l.Back().Value)
+		require.Equal(t, l.Front(), l.Back())
+	})
+
+	t.Run("move middle to front", func(t *testing.T) {
+		l := NewList()
+
+		l.PushBack(10) // [10]
+		l.PushBack(20) // [10, 20]
+		l.PushBack(30) // [10, 20, 30]
+
+		l.MoveToFront(l.Front().Next) // [20, 10, 30]
+		require.Equal(t, 20, l.Front().Value)
+		require.Nil(t, l.Front().Prev)
+
+		elems := make([]int, 0, l.Len())
+		for i := l.Back(); i != nil; i = i.Prev {
+			elems = append(elems, i.Value.(int))
+		}
+		require.Equal(t, []int{30, 10, 20}, elems)
+	})
+
+	t.Run("insert after", func(t *testing.T) {
+		l := NewList()
+
+		l.PushBack(10)               // [10]
+		l.InsertAfter(30, l.Front()) // [10, 30]
+		l.InsertAfter(20, l.Front()) // [10, 20, 30]
+		l.InsertAfter(40, l.Back())  // [10, 20, 30, 40]
+		require.Equal(t, 4, l.Len())
+		require.Equal(t, 40, l.Back().Value)
+
+		elems := make([]int, 0, l.Len())
+		for i := l.Back(); i != nil; i = i.Prev {
+			elems = append(elems, i.Value.(int))
+		}
+		require.Equal(t, []int{40, 30, 20, 10}, elems)
+	})
 }
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-memory LRU cache limited by the total size of stored values.
+type MemoryCache struct {
+	maxBytes int64
+	size     int64
+	queue    List
+	items    map[string]*ListItem
+	sources  sourceIndex
+	mutex    sync.Mutex
+	stats    Stats
+}
+
+type memoryItem struct {
+	key  string
+	item *Item
+}
+
+// NewMemoryCache is an in-memory cache constructor.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		queue:    NewList(),
+		items:    make(map[string]*ListItem),
+		sources:  make(sourceIndex),
+	}
+}
+
+// Get returns item if exists, or error, if doesnt.
+func (m *MemoryCache) Get(key string) (*Item, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	listItem, exists := m.items[key]
+	if !exists {
+		m.stats.Misses++
+		return nil, ErrItemNotExists
+	}
+
+	if listItem.Value.(memoryItem).item.Expired(time.Now()) {
+		m.remove(listItem)
+		m.stats.Misses++
+
+		return nil, ErrItemNotExists
+	}
+
+	m.queue.MoveToFront(listItem)
+	m.stats.Hits++
+
+	return listItem.Value.(memoryItem).item, nil
+}
+
+// Set sets or updates item, evicting least recently used items until the byte budget is met.
+// Items larger than the whole budget are not stored.
+func (m *MemoryCache) Set(key string, item *Item) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if listItem, exists := m.items[key]; exists {
+		m.remove(listItem)
+	}
+
+	if int64(len(item.Value)) > m.maxBytes {
+		return nil
+	}
+
+	m.items[key] = m.queue.PushFront(memoryItem{key, item})
+	m.sources.add(item.Source, key)
+	m.size += int64(len(item.Value))
+
+	for m.size > m.maxBytes {
+		m.remove(m.queue.Back())
+		m.stats.Evictions++
+	}
+
+	return nil
+}
+
+// Clear removes all items.
+func (m *MemoryCache) Clear() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.queue = NewList()
+	m.items = make(map[string]*ListItem)
+	m.sources = make(sourceIndex)
+	m.size = 0
+}
+
+// RemoveExpired removes expired items, returning count of removed items.
+func (m *MemoryCache) RemoveExpired() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	removed := 0
+
+	for _, listItem := range m.items {
+		if listItem.Value.(memoryItem).item.Expired(now) {
+			m.remove(listItem)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Delete removes the item, reporting whether it has existed.
+func (m *MemoryCache) Delete(key string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	listItem, exists := m.items[key]
+	if exists {
+		m.remove(listItem)
+	}
+
+	return exists
+}
+
+// DeleteFunc removes items, which keys match, returning count of removed items.
+func (m *MemoryCache) DeleteFunc(match func(key string) bool) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	deleted := 0
+
+	for key, listItem := range m.items {
+		if match(key) {
+			m.remove(listItem)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Variants returns keys of items derived from the source.
+func (m *MemoryCache) Variants(source string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.sources.keys(source)
+}
+
+// DeleteVariants removes items derived from the source, returning count of removed items.
+func (m *MemoryCache) DeleteVariants(source string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := m.sources.keys(source)
+	for _, key := range keys {
+		m.remove(m.items[key])
+	}
+
+	return len(keys)
+}
+
+// Entries returns descriptions of all items.
+func (m *MemoryCache) Entries() []Entry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entries := make([]Entry, 0, len(m.items))
+	for key, listItem := range m.items {
+		item := listItem.Value.(memoryItem).item
+		entries = append(entries, Entry{key, int64(len(item.Value)), item.Hash, item.ModTime, item.ExpiresAt, item.Source})
+	}
+
+	return entries
+}
+
+// Stats returns a snapshot of cache counters.
+func (m *MemoryCache) Stats() Stats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.stats
+	stats.Items = int64(len(m.items))
+	stats.Bytes = m.size
+
+	return stats
+}
+
+// remove deletes element from queue and map.
+func (m *MemoryCache) remove(listItem *ListItem) {
+	element := listItem.Value.(memoryItem)
+
+	delete(m.items, element.key)
+	m.sources.remove(element.item.Source, element.key)
+	m.queue.Remove(listItem)
+	m.size -= int64(len(element.item.Value))
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyTinyLFU = "tinylfu"
+	PolicyARC     = "arc"
+)
+
+// Policy decides which keys stay in a cache of limited capacity. It tracks keys only,
+// values are kept by the cache itself. Policies are not safe for concurrent use.
+type Policy interface {
+	// Access records a hit of a key present in the cache.
+	Access(key string)
+	// Add records a new key, returning whether it is admitted and keys evicted to make room.
+	// Evicted keys are forgotten by the policy itself, unless it remembers them as ghosts.
+	Add(key string) (admitted bool, evicted []string)
+	// Remove forgets a key.
+	Remove(key string)
+	// Len returns count of keys present in the cache.
+	Len() int
+}
+
+var ErrUnknownPolicy = errors.New("unknown eviction policy")
+
+// NewPolicy is a policy constructor: returns the policy by its name, LRU is the default one.
+func NewPolicy(name string, capacity int) (Policy, error) {
+	switch name {
+	case PolicyLRU, "":
+		return NewLRUPolicy(capacity), nil
+	case PolicyLFU:
+		return NewLFUPolicy(capacity), nil
+	case PolicyTinyLFU:
+		return NewTinyLFUPolicy(capacity), nil
+	case PolicyARC:
+		return NewARCPolicy(capacity), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPolicy, name)
+	}
+}
+
+// LRUPolicy evicts the least recently used key.
+type LRUPolicy struct {
+	capacity int
+	queue    List
+	items    map[string]*ListItem
+}
+
+// NewLRUPolicy is a LRU policy constructor.
+func NewLRUPolicy(capacity int) *LRUPolicy {
+	return &LRUPolicy{
+		capacity: capacity,
+		queue:    NewList(),
+		items:    make(map[string]*ListItem, capacity),
+	}
+}
+
+// Access moves key to front.
+func (p *LRUPolicy) Access(key string) {
+	if item, exists := p.items[key]; exists {
+		p.queue.MoveToFront(item)
+	}
+}
+
+// Add puts key to front, evicting the back one if list exceeds capacity.
+func (p *LRUPolicy) Add(key string) (bool, []string) {
+	p.items[key] = p.queue.PushFront(key)
+
+	if p.queue.Len() <= p.capacity {
+		return true, nil
+	}
+
+	back := p.queue.Back()
+	p.Remove(back.Value.(string))
+
+	return true, []string{back.Value.(string)}
+}
+
+// Remove forgets a key.
+func (p *LRUPolicy) Remove(key string) {
+	if item, exists := p.items[key]; exists {
+		p.queue.Remove(item)
+		delete(p.items, key)
+	}
+}
+
+// Len returns count of keys.
+func (p *LRUPolicy) Len() int {
+	return p.queue.Len()
+}
@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var policies = []string{PolicyLRU, PolicyLFU, PolicyTinyLFU, PolicyARC}
+
+// policySimulator keeps the set of keys a cache would hold, following policy decisions.
+type policySimulator struct {
+	policy  Policy
+	present map[string]bool
+	hits    int
+	misses  int
+}
+
+func newPolicySimulator(t testing.TB, name string, capacity int) *policySimulator {
+	t.Helper()
+
+	policy, err := NewPolicy(name, capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &policySimulator{policy: policy, present: make(map[string]bool)}
+}
+
+// request simulates a cache lookup, followed by a set on miss.
+func (s *policySimulator) request(key string) {
+	if s.present[key] {
+		s.hits++
+		s.policy.Access(key)
+
+		return
+	}
+
+	s.misses++
+
+	admitted, evicted := s.policy.Add(key)
+	if admitted {
+		s.present[key] = true
+	}
+
+	for _, k := range evicted {
+		delete(s.present, k)
+	}
+}
+
+func (s *policySimulator) hitRatio() float64 {
+	return float64(s.hits) / float64(s.hits+s.misses)
+}
+
+// zipfScanTrace generates popular keys following Zipf distribution, interrupted by scans of one-off keys.
+func zipfScanTrace(length, keys, scanEvery, scanLength int) []string {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.1, 1, uint64(keys-1))
+
+	trace := make([]string, 0, length)
+	scanned := 0
+
+	for len(trace) < length {
+		if scanEvery > 0 && len(trace)%scanEvery == 0 {
+			for i := 0; i < scanLength; i++ {
+				trace = append(trace, "scan-"+strconv.Itoa(scanned))
+				scanned++
+			}
+		}
+
+		trace = append(trace, "key-"+strconv.FormatUint(zipf.Uint64(), 10))
+	}
+
+	return trace
+}
+
+func TestPolicy(t *testing.T) {
+	t.Run("unknown policy", func(t *testing.T) {
+		_, err := NewPolicy("random", 10)
+		require.Truef(t, errors.Is(err, ErrUnknownPolicy), "actual error %q", err)
+	})
+
+	for _, name := range policies {
+		name := name
+
+		t.Run(name, func(t *testing.T) {
+			t.Run("capacity", func(t *testing.T) {
+				s := newPolicySimulator(t, name, 50)
+
+				for _, key := range zipfScanTrace(10_000, 500, 1_000, 100) {
+					s.request(key)
+
+					require.LessOrEqual(t, s.policy.Len(), 50)
+					require.Equal(t, len(s.present), s.policy.Len())
+				}
+			})
+
+			t.Run("remove", func(t *testing.T) {
+				s := newPolicySimulator(t, name, 2)
+
+				s.request("aaa")
+				s.request("bbb")
+
+				s.policy.Remove("aaa")
+				delete(s.present, "aaa")
+				require.Equal(t, 1, s.policy.Len())
+
+				// There is room after removal, nothing has to be evicted.
+				_, evicted := s.policy.Add("ccc")
+				require.Empty(t, evicted)
+				require.Equal(t, 2, s.policy.Len())
+			})
+
+			t.Run("zero capacity", func(t *testing.T) {
+				s := newPolicySimulator(t, name, 0)
+
+				s.request("aaa")
+				s.request("aaa")
+				require.Equal(t, 0, s.hits)
+				require.Equal(t, 0, s.policy.Len())
+			})
+		})
+	}
+
+	t.Run("lru order", func(t *testing.T) {
+		p := NewLRUPolicy(2)
+
+		p.Add("aaa")
+		p.Add("bbb")
+		p.Access("aaa")
+
+		_, evicted := p.Add("ccc")
+		require.Equal(t, []string{"bbb"}, evicted)
+	})
+
+	t.Run("lfu order", func(t *testing.T) {
+		p := NewLFUPolicy(2)
+
+		p.Add("aaa")
+		p.Access("aaa")
+		p.Add("bbb")
+
+		_, evicted := p.Add("ccc")
+		require.Equal(t, []string{"bbb"}, evicted)
+
+		// Least recently used key is evicted among equally frequent ones.
+		p.Access("ccc")
+		_, evicted = p.Add("ddd")
+		require.Equal(t, []string{"aaa"}, evicted)
+	})
+
+	t.Run("scan resistance", func(t *testing.T) {
+		for _, name := range []string{PolicyTinyLFU, PolicyARC} {
+			s := newPolicySimulator(t, name, 100)
+
+			for round := 0; round < 10; round++ {
+				for i := 0; i < 50; i++ {
+					s.request("hot-" + strconv.Itoa(i))
+				}
+			}
+
+			for i := 0; i < 1_000; i++ {
+				s.request("scan-" + strconv.Itoa(i))
+			}
+
+			survived := 0
+			for i := 0; i < 50; i++ {
+				if s.present["hot-"+strconv.Itoa(i)] {
+					survived++
+				}
+			}
+
+			require.Greaterf(t, survived, 40, "%s kept %d hot keys out of 50", name, survived)
+		}
+	})
+
+	t.Run("arc in cache", func(t *testing.T) {
+		c, err := newLruCache(3, t.TempDir(), PolicyARC, newTestLogger(t))
+		require.NoError(t, err)
+
+		arc := c.policy.(*ARCPolicy)
+
+		require.NoError(t, c.Set("aaa", NewItem([]byte("aaa"))))
+		require.NoError(t, c.Set("bbb", NewItem([]byte("bbb"))))
+
+		// The hit moves "aaa" to T2, so that "bbb" is the one evicted from T1.
+		_, err = c.Get("aaa")
+		require.NoError(t, err)
+
+		require.NoError(t, c.Set("ccc", NewItem([]byte("ccc"))))
+		require.NoError(t, c.Set("ddd", NewItem([]byte("ddd"))))
+
+		// Evicted key is remembered as a ghost, rather than forgotten by the cache.
+		require.Equal(t, 1, arc.lists[arcB1].Len())
+		_, err = c.Get("bbb")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		// Ghost hit adapts the target and puts the key to T2.
+		require.NoError(t, c.Set("bbb", NewItem([]byte("bbb"))))
+		require.Equal(t, 1, arc.target)
+		require.Equal(t, arcT2, arc.items["bbb"].Value.(*arcEntry).list)
+		require.Equal(t, 3, arc.Len())
+		require.Equal(t, int64(3), c.Stats().Items)
+	})
+}
+
+// BenchmarkPolicy replays a synthetic trace against every policy, reporting hit ratio along with timings.
+func BenchmarkPolicy(b *testing.B) {
+	traces := map[string][]string{
+		"zipf":      zipfScanTrace(100_000, 10_000, 0, 0),
+		"zipf-scan": zipfScanTrace(100_000, 10_000, 5_000, 2_000),
+	}
+
+	for traceName, trace := range traces {
+		for _, name := range policies {
+			b.Run(traceName+"/"+name, func(b *testing.B) {
+				var s *policySimulator
+
+				for i := 0; i < b.N; i++ {
+					s = newPolicySimulator(b, name, 500)
+					for _, key := range trace {
+						s.request(key)
+					}
+				}
+
+				b.ReportMetric(s.hitRatio(), "hit-ratio")
+			})
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisFieldValue   = "value"
+	redisFieldHash    = "hash"
+	redisFieldModTime = "modtime"
+	redisFieldExpires = "expires"
+	redisFieldSource  = "source"
+	redisFieldFresh   = "fresh"
+	redisScanCount    = 1000
+	// redisSourcePrefix follows the cache prefix in keys of sets, which index variants of a source.
+	redisSourcePrefix = "source:"
+)
+
+// redisIndexScript adds the item key to the index set of its source, keeping the set as long as its
+// longest-living item: a set expires with its items, unless one of them never expires.
+// ARGV[2] is TTL of the item in milliseconds, zero if it never expires.
+var redisIndexScript = redis.NewScript(`
+local existed = redis.call("EXISTS", KEYS[1])
+redis.call("SADD", KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call("PERSIST", KEYS[1])
+elseif existed == 0 then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+else
+	local current = redis.call("PTTL", KEYS[1])
+	if current >= 0 and current < ttl then
+		redis.call("PEXPIRE", KEYS[1], ttl)
+	end
+end
+return 1
+`)
+
+// RedisCache stores items in a network cache speaking the Redis protocol, so that it can be shared
+// between replicas. It doesn't limit its size: configure maxmemory with an allkeys-lru policy instead.
+// Items with expiration moment are expired by Redis itself.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+	logger Logger
+	stats  Stats
+}
+
+var (
+	ErrRedisSet   = errors.New("unable to set redis item")
+	ErrRedisGet   = errors.New("unable to get redis item")
+	ErrRedisClear = errors.New("unable to clear redis cache")
+	ErrRedisScan  = errors.New("unable to scan redis cache")
+)
+
+// NewRedisCache is a Redis cache constructor.
+func NewRedisCache(config Config, logger Logger) (*RedisCache, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.GetCacheRedisAddress(),
+		Password: config.GetCacheRedisPassword(),
+		DB:       config.GetCacheRedisDB(),
+	})
+
+	return &RedisCache{
+		client: client,
+		prefix: config.GetCacheRedisPrefix(),
+		logger: logger,
+	}, nil
+}
+
+// Get returns item if exists, or error, if doesnt.
+func (r *RedisCache) Get(key string) (*Item, error) {
+	fields, err := r.client.HGetAll(context.Background(), r.prefix+key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRedisGet, err)
+	}
+
+	// Missing keys are reported as empty hashes.
+	value, exists := fields[redisFieldValue]
+	if !exists {
+		atomic.AddUint64(&r.stats.Misses, 1)
+		return nil, ErrItemNotExists
+	}
+
+	modTime, err := strconv.ParseInt(fields[redisFieldModTime], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRedisGet, err)
+	}
+
+	item := &Item{
+		Value:   []byte(value),
+		Hash:    fields[redisFieldHash],
+		ModTime: time.Unix(modTime, 0).UTC(),
+		Source:  fields[redisFieldSource],
+	}
+
+	// Zero stands for items that never expire, the field is missing in items stored by previous versions.
+	if expires, err := strconv.ParseInt(fields[redisFieldExpires], 10, 64); err == nil && expires > 0 {
+		item.ExpiresAt = time.Unix(expires, 0).UTC()
+	}
+
+	if fresh, err := strconv.ParseInt(fields[redisFieldFresh], 10, 64); err == nil && fresh > 0 {
+		item.FreshUntil = time.Unix(fresh, 0).UTC()
+	}
+
+	atomic.AddUint64(&r.stats.Hits, 1)
+
+	return item, nil
+}
+
+// Set stores item value along with its metadata as a single hash.
+func (r *RedisCache) Set(key string, item *Item) error {
+	ctx := context.Background()
+
+	var expires, fresh int64
+	if !item.ExpiresAt.IsZero() {
+		expires = item.ExpiresAt.Unix()
+	}
+
+	if !item.FreshUntil.IsZero() {
+		fresh = item.FreshUntil.Unix()
+	}
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.prefix+key,
+			redisFieldValue, item.Value,
+			redisFieldHash, item.Hash,
+			redisFieldModTime, item.ModTime.Unix(),
+			redisFieldExpires, expires,
+			redisFieldSource, item.Source,
+			redisFieldFresh, fresh,
+		)
+
+		if item.Source != "" {
+			redisIndexScript.Eval(ctx, pipe, []string{r.sourceKey(item.Source)}, key, indexTTL(item).Milliseconds())
+		}
+
+		// Overwritten items must not inherit expiration of previous ones.
+		if item.ExpiresAt.IsZero() {
+			pipe.Persist(ctx, r.prefix+key)
+		} else {
+			pipe.PExpireAt(ctx, r.prefix+key, item.ExpiresAt)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRedisSet, err)
+	}
+
+	return nil
+}
+
+// Clear removes every key under the cache prefix. It refuses to clear without a prefix,
+// since that would flush the whole database.
+func (r *RedisCache) Clear() {
+	ctx := context.Background()
+
+	if r.prefix == "" {
+		r.logger.Error(fmt.Errorf("%w: no prefix configured", ErrRedisClear))
+		return
+	}
+
+	iterator := r.client.Scan(ctx, 0, r.prefix+"*", redisScanCount).Iterator()
+	for iterator.Next(ctx) {
+		if err := r.client.Del(ctx, iterator.Val()).Err(); err != nil {
+			r.logger.Error(fmt.Errorf("%w: %s", ErrRedisClear, err))
+		}
+	}
+
+	if err := iterator.Err(); err != nil {
+		r.logger.Error(fmt.Errorf("%w: %s", ErrRedisClear, err))
+	}
+}
+
+// Delete removes the item, reporting whether it has existed.
+func (r *RedisCache) Delete(key string) bool {
+	ctx := context.Background()
+
+	source, err := r.client.HGet(ctx, r.prefix+key, redisFieldSource).Result()
+	if err == nil && source != "" {
+		if err := r.client.SRem(ctx, r.sourceKey(source), key).Err(); err != nil {
+			r.logger.Error(fmt.Errorf("%w: %s", ErrRedisClear, err))
+		}
+	}
+
+	deleted, err := r.client.Del(ctx, r.prefix+key).Result()
+	if err != nil {
+		r.logger.Error(fmt.Errorf("%w: %s", ErrRedisClear, err))
+	}
+
+	return deleted > 0
+}
+
+// Variants returns keys of existing items derived from the source. Keys of items expired or evicted
+// by Redis are pruned from the index set.
+func (r *RedisCache) Variants(source string) []string {
+	ctx := context.Background()
+
+	members, err := r.client.SMembers(ctx, r.sourceKey(source)).Result()
+	if err != nil {
+		r.logger.Error(fmt.Errorf("%w: %s", ErrRedisGet, err))
+		return nil
+	}
+
+	keys := make([]string, 0, len(members))
+	for _, key := range members {
+		exists, err := r.client.Exists(ctx, r.prefix+key).Result()
+		if err != nil {
+			r.logger.Error(fmt.Errorf("%w: %s", ErrRedisGet, err))
+			continue
+		}
+
+		if exists > 0 {
+			keys = append(keys, key)
+		} else if err := r.client.SRem(ctx, r.sourceKey(source), key).Err(); err != nil {
+			r.logger.Error(fmt.Errorf("%w: %s", ErrRedisClear, err))
+		}
+	}
+
+	return keys
+}
+
+// DeleteVariants removes items derived from the source along with the index set.
+func (r *RedisCache) DeleteVariants(source string) int {
+	ctx := context.Background()
+
+	members, err := r.client.SMembers(ctx, r.sourceKey(source)).Result()
+	if err != nil {
+		r.logger.Error(fmt.Errorf("%w: %s", ErrRedisClear, err))
+		return 0
+	}
+
+	deleted := 0
+	for _, key := range members {
+		if n, err := r.client.Del(ctx, r.prefix+key).Result(); err == nil {
+			deleted += int(n)
+		}
+	}
+
+	if err := r.client.Del(ctx, r.sourceKey(source)).Err(); err != nil {
+		r.logger.Error(fmt.Errorf("%w: %s", ErrRedisClear, err))
+	}
+
+	return deleted
+}
+
+// DeleteFunc removes items, which keys match, returning count of removed items.
+func (r *RedisCache) DeleteFunc(match func(key string) bool) int {
+	deleted := 0
+
+	for _, key := range r.keys() {
+		if match(key) && r.Delete(key) {
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// Entries returns descriptions of all items, reading metadata of each of them.
+func (r *RedisCache) Entries() []Entry {
+	ctx := context.Background()
+	keys := r.keys()
+	entries := make([]Entry, 0, len(keys))
+
+	for _, key := range keys {
+		var (
+			fields *redis.SliceCmd
+			size   *redis.Cmd
+		)
+
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			fields = pipe.HMGet(ctx, r.prefix+key, redisFieldHash, redisFieldModTime, redisFieldExpires, redisFieldSource)
+			size = pipe.Do(ctx, "hstrlen", r.prefix+key, redisFieldValue)
+
+			return nil
+		})
+		if err != nil {
+			r.logger.Error(fmt.Errorf("%w: %s", ErrRedisScan, err))
+			continue
+		}
+
+		// Item may have been removed or expired since scanning.
+		values := fields.Val()
+		if values[0] == nil {
+			continue
+		}
+
+		entry := Entry{Key: key}
+		entry.Size, _ = size.Int64()
+		entry.Hash, _ = values[0].(string)
+
+		if modTime, err := strconv.ParseInt(fmt.Sprint(values[1]), 10, 64); err == nil {
+			entry.ModTime = time.Unix(modTime, 0).UTC()
+		}
+
+		if expires, err := strconv.ParseInt(fmt.Sprint(values[2]), 10, 64); err == nil && expires > 0 {
+			entry.ExpiresAt = time.Unix(expires, 0).UTC()
+		}
+
+		entry.Source, _ = values[3].(string)
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Stats returns hit and miss counters only. Count and size of items are left out, since they
+// would require scanning the keyspace on every call, Entries lists items on demand instead.
+func (r *RedisCache) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&r.stats.Hits),
+		Misses: atomic.LoadUint64(&r.stats.Misses),
+	}
+}
+
+// keys returns keys of all items, without the cache prefix.
+func (r *RedisCache) keys() []string {
+	ctx := context.Background()
+	keys := make([]string, 0)
+
+	iterator := r.client.Scan(ctx, 0, r.prefix+"*", redisScanCount).Iterator()
+	for iterator.Next(ctx) {
+		if key := strings.TrimPrefix(iterator.Val(), r.prefix); !strings.HasPrefix(key, redisSourcePrefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	if err := iterator.Err(); err != nil {
+		r.logger.Error(fmt.Errorf("%w: %s", ErrRedisScan, err))
+	}
+
+	return keys
+}
+
+// indexTTL returns TTL of the item for its index set, zero if it never expires.
+// Items, which have expired already, are kept in the set for a moment at least.
+func indexTTL(item *Item) time.Duration {
+	if item.ExpiresAt.IsZero() {
+		return 0
+	}
+
+	if ttl := time.Until(item.ExpiresAt); ttl > time.Millisecond {
+		return ttl
+	}
+
+	return time.Millisecond
+}
+
+// sourceKey returns key of the set indexing variants of the source.
+func (r *RedisCache) sourceKey(source string) string {
+	return r.prefix + redisSourcePrefix + source
+}
+
+// Close closes the connection pool.
+func (r *RedisCache) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisCache(t *testing.T) {
+	newRedisCache := func(t *testing.T, server *miniredis.Miniredis, prefix string) *RedisCache {
+		t.Helper()
+
+		config := newTestConfig(t)
+		config.Cache.Redis.Address = server.Addr()
+		config.Cache.Redis.Prefix = prefix
+
+		c, err := NewRedisCache(config, newTestLogger(t))
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+
+		return c
+	}
+
+	newSourceItem := func(ttl time.Duration) *Item {
+		item := NewItem([]byte("aaa"))
+		item.Source = "example.com/a.jpg"
+		if ttl > 0 {
+			item.ExpiresAt = item.ModTime.Add(ttl)
+		}
+
+		return item
+	}
+
+	t.Run("index expiration", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		c := newRedisCache(t, server, "previewer:")
+		index := c.sourceKey("example.com/a.jpg")
+
+		require.NoError(t, c.Set("a-1", newSourceItem(time.Hour)))
+		require.InDelta(t, time.Hour, server.TTL(index), float64(time.Second))
+
+		// The set lives as long as its longest-living item.
+		require.NoError(t, c.Set("a-2", newSourceItem(2*time.Hour)))
+		require.InDelta(t, 2*time.Hour, server.TTL(index), float64(time.Second))
+
+		require.NoError(t, c.Set("a-3", newSourceItem(time.Minute)))
+		require.InDelta(t, 2*time.Hour, server.TTL(index), float64(time.Second))
+
+		// Items, which never expire, keep the set too.
+		require.NoError(t, c.Set("a-4", newSourceItem(0)))
+		require.Equal(t, time.Duration(0), server.TTL(index))
+
+		require.NoError(t, c.Set("a-5", newSourceItem(time.Minute)))
+		require.Equal(t, time.Duration(0), server.TTL(index))
+	})
+
+	t.Run("index pruning", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		c := newRedisCache(t, server, "previewer:")
+
+		require.NoError(t, c.Set("a-1", newSourceItem(time.Minute)))
+		require.NoError(t, c.Set("a-2", newSourceItem(time.Hour)))
+
+		// Redis expires items by itself, their keys are pruned from the index on lookup.
+		server.FastForward(2 * time.Minute)
+
+		require.Equal(t, []string{"a-2"}, c.Variants("example.com/a.jpg"))
+
+		members, err := server.Members(c.sourceKey("example.com/a.jpg"))
+		require.NoError(t, err)
+		require.Equal(t, []string{"a-2"}, members)
+
+		server.FastForward(time.Hour)
+		require.False(t, server.Exists(c.sourceKey("example.com/a.jpg")))
+	})
+
+	t.Run("clear without prefix", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		require.NoError(t, server.Set("foreign", "foreign"))
+
+		c := newRedisCache(t, server, "")
+		require.NoError(t, c.Set("aaa", NewItem([]byte("aaa"))))
+
+		// Clearing without a prefix would flush the whole database.
+		c.Clear()
+
+		require.True(t, server.Exists("foreign"))
+
+		_, err := c.Get("aaa")
+		require.NoError(t, err)
+	})
+}
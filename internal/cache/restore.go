@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacyMode is the mode of items cached before transformation keys, every one of them was filled.
+const legacyMode = "fill"
+
+type restoredItem struct {
+	filename string
+	meta     fileMeta
+}
+
+// scan collects items from sidecar files, so that the index can be rebuilt and the cache survives restarts.
+// Items are sorted by modification time, most recently modified ones are considered most recently used.
+// Leftovers of interrupted writes are removed: temporary files, files without sidecars and vice versa.
+func (l *LruCache) scan() ([]restoredItem, error) {
+	restored := make([]restoredItem, 0)
+	sizes := make(map[string]int64)
+
+	err := filepath.WalkDir(l.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		if strings.HasPrefix(d.Name(), tmpPrefix) {
+			l.removeLeftover(path)
+			return nil
+		}
+
+		if !strings.HasSuffix(path, metaSuffix) {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			sizes[path] = info.Size()
+
+			return nil
+		}
+
+		filename, err := filepath.Rel(l.path, strings.TrimSuffix(path, metaSuffix))
+		if err != nil {
+			return err
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			l.logger.Warn(fmt.Errorf("%w: %s", ErrFileRead, err))
+			return nil
+		}
+
+		var meta fileMeta
+		if err := json.Unmarshal(content, &meta); err != nil {
+			l.logger.Warn(fmt.Errorf("%w: %s: %s", ErrFileRead, path, err))
+			l.removeLeftover(path)
+			return nil
+		}
+
+		restored = append(restored, restoredItem{filename, meta})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileRead, err)
+	}
+
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].meta.ModTime.Before(restored[j].meta.ModTime)
+	})
+
+	valid := make([]restoredItem, 0, len(restored))
+
+	for _, r := range restored {
+		absFilename := filepath.Join(l.path, r.filename)
+
+		size, exists := sizes[absFilename]
+		delete(sizes, absFilename)
+
+		// Items expired while the service was down are removed as well.
+		if !exists || size != r.meta.Size || isExpired(r.meta.ExpiresAt, time.Now()) {
+			l.removeLeftover(absFilename)
+			l.removeLeftover(absFilename + metaSuffix)
+			continue
+		}
+
+		valid = append(valid, r)
+	}
+
+	// Only files without sidecars are left, unless they are legacy or foreign ones in the cache root.
+	for absFilename := range sizes {
+		if filepath.Dir(absFilename) != filepath.Clean(l.path) {
+			l.removeLeftover(absFilename)
+		}
+	}
+
+	if len(valid) > 0 {
+		l.logger.Info(fmt.Sprintf("found %d cache items in %s", len(valid), l.path))
+	}
+
+	return valid, nil
+}
+
+// load puts restored items to the index, evicting ones the policy doesn't keep.
+func (l *LruCache) load(restored []restoredItem) {
+	l.mutex.Lock()
+	evicted := make([]cacheItem, 0)
+
+	for _, r := range restored {
+		element := cacheItem{
+			r.meta.Key, r.filename, r.meta.Hash, r.meta.Size, r.meta.ModTime, r.meta.ExpiresAt, r.meta.FreshUntil, r.meta.Source,
+		}
+		evicted = append(evicted, l.add(element)...)
+	}
+
+	l.mutex.Unlock()
+
+	l.removeFiles(evicted...)
+}
+
+// removeLeftover removes a file, which doesn't belong to any cache item.
+func (l *LruCache) removeLeftover(absFilename string) {
+	if err := os.Remove(absFilename); err != nil && !os.IsNotExist(err) {
+		l.logger.Error(fmt.Errorf("%w: %s", ErrFileRemove, err))
+	}
+}
+
+// migrateLegacyFiles moves files named by base64-encoded keys in the cache root to the sharded layout.
+// Legacy keys, i.e. url-width-height, are converted to transformation keys, so that items are found
+// and purged by their sources. Files, which keys can't be converted, would never be hit, so they are removed.
+func (l *LruCache) migrateLegacyFiles() error {
+	entries, err := os.ReadDir(l.path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFileRead, err)
+	}
+
+	migrated := 0
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		// Files which names are not base64 don't belong to the legacy layout.
+		key, err := base64.StdEncoding.DecodeString(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		legacyFilename := filepath.Join(l.path, entry.Name())
+
+		transformKey, err := parseLegacyKey(string(key))
+		if err != nil {
+			l.logger.Warn(err)
+			l.removeLeftover(legacyFilename)
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			l.logger.Warn(fmt.Errorf("%w: %s", ErrFileRead, err))
+			continue
+		}
+
+		value, err := ioutil.ReadFile(legacyFilename)
+		if err != nil {
+			l.logger.Warn(fmt.Errorf("%w: %s", ErrFileRead, err))
+			continue
+		}
+
+		item := NewItem(value)
+		item.ModTime = info.ModTime().UTC().Truncate(time.Second)
+		item.Source = transformKey.Source
+
+		if err := l.saveToFileSystem(encodeFileName(transformKey.String(), item.Hash), transformKey.String(), item); err != nil {
+			l.logger.Error(fmt.Errorf("%w: %s", ErrFileWrite, err))
+			continue
+		}
+
+		if err := os.Remove(legacyFilename); err != nil {
+			l.logger.Error(fmt.Errorf("%w: %s", ErrFileRemove, err))
+			continue
+		}
+
+		migrated++
+	}
+
+	if migrated > 0 {
+		l.logger.Info(fmt.Sprintf("migrated %d legacy cache files in %s", migrated, l.path))
+	}
+
+	return nil
+}
+
+// parseLegacyKey converts a legacy key, i.e. url-width-height, to the transformation key of the same variant.
+func parseLegacyKey(key string) (TransformKey, error) {
+	transformKey := TransformKey{Mode: legacyMode}
+
+	rest, height, err := cutLegacyDimension(key)
+	if err == nil {
+		transformKey.Height = height
+		transformKey.Source, transformKey.Width, err = cutLegacyDimension(rest)
+	}
+
+	if err != nil || transformKey.Source == "" {
+		return TransformKey{}, fmt.Errorf("%w: legacy key %s", ErrKeyParse, key)
+	}
+
+	return transformKey, nil
+}
+
+// cutLegacyDimension splits the last dimension off the legacy key.
+func cutLegacyDimension(key string) (string, int, error) {
+	i := strings.LastIndex(key, "-")
+	if i < 0 {
+		return "", 0, ErrKeyParse
+	}
+
+	dimension, err := strconv.Atoi(key[i+1:])
+
+	return key[:i], dimension, err
+}
@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	internallogger "github.com/spendmail/previewer/internal/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLruCacheRestore(t *testing.T) {
+	t.Run("file names", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+
+		c := newTestCache(t, config)
+
+		// Long keys with slashes used to break the filesystem cache.
+		key := "example.com/" + strings.Repeat("very/long/path/", 30) + "image.jpg-300-200"
+		err := c.Set(key, NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		val, err := c.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), val.Value)
+
+		filename := filepath.Join(config.GetCachePath(), encodeFileName(key, NewItem([]byte("aaa")).Hash))
+		require.FileExists(t, filename)
+		require.FileExists(t, filename+metaSuffix)
+		require.Len(t, filepath.Base(filename), 64+1+versionLength)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+		config.Cache.Capacity = 2
+
+		c := newTestCache(t, config)
+
+		item := NewItem([]byte("aaa"))
+		err := c.Set("aaa", item)
+		require.NoError(t, err)
+
+		c = newTestCache(t, config)
+
+		val, err := c.Get("aaa")
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), val.Value)
+		require.Equal(t, item.Hash, val.Hash)
+		require.True(t, item.ModTime.Equal(val.ModTime))
+	})
+
+	t.Run("source index", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+		config.Cache.Shards = 2
+
+		c := newTestCache(t, config)
+
+		for _, key := range []string{"a.jpg-1-1", "a.jpg-2-2", "a.jpg-3-3"} {
+			item := NewItem([]byte(key))
+			item.Source = "a.jpg"
+			require.NoError(t, c.Set(key, item))
+		}
+
+		// Index is restored from sidecar files.
+		c = newTestCache(t, config)
+
+		indexer, ok := c.(SourceIndexer)
+		require.True(t, ok)
+		require.ElementsMatch(t, []string{"a.jpg-1-1", "a.jpg-2-2", "a.jpg-3-3"}, indexer.Variants("a.jpg"))
+	})
+
+	t.Run("clear removes files", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+
+		c := newTestCache(t, config)
+
+		err := c.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		c.Clear()
+
+		filename := filepath.Join(config.GetCachePath(), encodeFileName("aaa", NewItem([]byte("aaa")).Hash))
+		require.NoFileExists(t, filename)
+		require.NoFileExists(t, filename+metaSuffix)
+
+		// Nothing is restored after restart.
+		c = newTestCache(t, config)
+
+		_, err = c.Get("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+	})
+
+	t.Run("expired items", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+
+		c := newTestCache(t, config)
+
+		item := NewItem([]byte("aaa"))
+		item.ExpiresAt = time.Now().Add(50 * time.Millisecond)
+		err := c.Set("aaa", item)
+		require.NoError(t, err)
+
+		time.Sleep(100 * time.Millisecond)
+
+		// Items expired while the service was down are neither restored nor kept on disk.
+		c = newTestCache(t, config)
+
+		_, err = c.Get("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		require.NoFileExists(t, filepath.Join(config.GetCachePath(), encodeFileName("aaa", NewItem([]byte("aaa")).Hash)))
+	})
+
+	t.Run("legacy migration", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+
+		legacyFilename := filepath.Join(config.GetCachePath(), base64.StdEncoding.EncodeToString([]byte("example.com/a-b.jpg-300-200")))
+		err := ioutil.WriteFile(legacyFilename, []byte("aaa"), 0o600)
+		require.NoError(t, err)
+
+		// Files, which keys aren't of the legacy format, would never be hit.
+		invalidFilename := filepath.Join(config.GetCachePath(), base64.StdEncoding.EncodeToString([]byte("aaa")))
+		err = ioutil.WriteFile(invalidFilename, []byte("aaa"), 0o600)
+		require.NoError(t, err)
+
+		// Unrelated files are left as they are.
+		foreignFilename := filepath.Join(config.GetCachePath(), "foreign.txt")
+		err = ioutil.WriteFile(foreignFilename, []byte("foreign"), 0o600)
+		require.NoError(t, err)
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err)
+
+		c, err := NewLruCache(config, logger)
+		require.NoError(t, err)
+
+		key := TransformKey{Source: "example.com/a-b.jpg", Mode: "fill", Width: 300, Height: 200}.String()
+		val, err := c.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), val.Value)
+		require.Equal(t, NewItem([]byte("aaa")).Hash, val.Hash)
+		require.Equal(t, "example.com/a-b.jpg", val.Source)
+		require.Equal(t, []string{key}, c.Variants("example.com/a-b.jpg"))
+		require.Equal(t, int64(1), c.Stats().Items)
+
+		_, err = os.Stat(legacyFilename)
+		require.Truef(t, errors.Is(err, os.ErrNotExist), "actual error %q", err)
+		require.NoFileExists(t, invalidFilename)
+		require.FileExists(t, foreignFilename)
+	})
+
+	t.Run("corrupted file", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+
+		c := newTestCache(t, config)
+
+		err := c.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		// Simulating a truncated write.
+		filename := filepath.Join(config.GetCachePath(), encodeFileName("aaa", NewItem([]byte("aaa")).Hash))
+		err = ioutil.WriteFile(filename, []byte("a"), 0o600)
+		require.NoError(t, err)
+
+		_, err = c.Get("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		require.NoFileExists(t, filename)
+		require.NoFileExists(t, filename+metaSuffix)
+
+		// Same length, but different content.
+		err = c.Set("bbb", NewItem([]byte("bbb")))
+		require.NoError(t, err)
+
+		filename = filepath.Join(config.GetCachePath(), encodeFileName("bbb", NewItem([]byte("bbb")).Hash))
+		err = ioutil.WriteFile(filename, []byte("ccc"), 0o600)
+		require.NoError(t, err)
+
+		_, err = c.Get("bbb")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		// Entry can be re-rendered afterwards.
+		err = c.Set("bbb", NewItem([]byte("bbb")))
+		require.NoError(t, err)
+
+		val, err := c.Get("bbb")
+		require.NoError(t, err)
+		require.Equal(t, []byte("bbb"), val.Value)
+	})
+
+	t.Run("interrupted writes", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.MemoryBytes = 0
+
+		c := newTestCache(t, config)
+
+		err := c.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		err = c.Set("bbb", NewItem([]byte("bbb")))
+		require.NoError(t, err)
+
+		// Crash before the sidecar was written.
+		filename := filepath.Join(config.GetCachePath(), encodeFileName("bbb", NewItem([]byte("bbb")).Hash))
+		err = os.Remove(filename + metaSuffix)
+		require.NoError(t, err)
+
+		// Crash in the middle of writing.
+		tmpFilename := filepath.Join(filepath.Dir(filename), tmpPrefix+"123")
+		err = ioutil.WriteFile(tmpFilename, []byte("b"), 0o600)
+		require.NoError(t, err)
+
+		c = newTestCache(t, config)
+
+		_, err = c.Get("aaa")
+		require.NoError(t, err)
+
+		_, err = c.Get("bbb")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		require.NoFileExists(t, filename)
+		require.NoFileExists(t, tmpFilename)
+	})
+}
@@ -0,0 +1,340 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	s3MetaHash    = "hash"
+	s3MetaModTime = "modtime"
+	s3MetaExpires = "expires"
+	s3MetaFresh   = "fresh"
+	s3MetaSource  = "source"
+	// s3MetaSourceLimit is the longest escaped source kept in metadata, which must fit 2 KB as a whole.
+	s3MetaSourceLimit = 1024
+	// s3SourcesPrefix follows the cache prefix in keys of index objects, one per variant of a source:
+	// sources/<source hash>/<key hash>, the body of an index object is the key of the variant.
+	s3SourcesPrefix = "sources/"
+	// s3DeleteLimit is the largest count of objects deleted by one request.
+	s3DeleteLimit = 1000
+)
+
+// S3API is the subset of the S3 client used by S3Cache.
+type S3API interface {
+	manager.UploadAPIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// S3Cache stores items in S3-compatible object storage, so that it can be shared between replicas.
+// It doesn't limit its size and doesn't remove expired objects: expired items are reported missing,
+// while their removal should be configured with bucket lifecycle rules.
+// Variants of a source are indexed by objects of their own, so that the index survives restarts.
+type S3Cache struct {
+	client   S3API
+	uploader *manager.Uploader
+	bucket   string
+	prefix   string
+	logger   Logger
+}
+
+var (
+	ErrS3Config = errors.New("unable to configure s3 client")
+	ErrS3Put    = errors.New("unable to put object to s3")
+	ErrS3Get    = errors.New("unable to get object from s3")
+	ErrS3Clear  = errors.New("unable to clear s3 cache")
+)
+
+// NewS3Cache is a S3 cache constructor: builds a client from config.
+func NewS3Cache(config Config, logger Logger) (*S3Cache, error) {
+	options := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(config.GetCacheS3Region()),
+	}
+
+	// Static credentials are optional: otherwise the default chain (env, shared config, IAM role) is used.
+	if config.GetCacheS3AccessKey() != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			config.GetCacheS3AccessKey(),
+			config.GetCacheS3SecretKey(),
+			"",
+		)))
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrS3Config, err)
+	}
+
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if endpoint := config.GetCacheS3Endpoint(); endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(endpoint)
+		}
+		o.UsePathStyle = config.GetCacheS3PathStyle()
+	})
+
+	return NewS3CacheWithClient(client, config.GetCacheS3Bucket(), config.GetCacheS3Prefix(), logger), nil
+}
+
+// NewS3CacheWithClient is a S3 cache constructor using the given client.
+func NewS3CacheWithClient(client S3API, bucket, prefix string, logger Logger) *S3Cache {
+	return &S3Cache{
+		client:   client,
+		uploader: manager.NewUploader(client),
+		bucket:   bucket,
+		prefix:   prefix,
+		logger:   logger,
+	}
+}
+
+// Get downloads an object and restores item metadata from object metadata.
+func (s *S3Cache) Get(key string) (*Item, error) {
+	output, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrItemNotExists
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrS3Get, err)
+	}
+	defer output.Body.Close()
+
+	value, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrS3Get, err)
+	}
+
+	modTime, err := time.Parse(time.RFC3339, output.Metadata[s3MetaModTime])
+	if err != nil && output.LastModified != nil {
+		modTime = output.LastModified.UTC()
+	}
+
+	item := &Item{
+		Value:   value,
+		Hash:    output.Metadata[s3MetaHash],
+		ModTime: modTime,
+	}
+
+	if expires, exists := output.Metadata[s3MetaExpires]; exists {
+		if expiresAt, err := time.Parse(time.RFC3339, expires); err == nil {
+			item.ExpiresAt = expiresAt
+		}
+	}
+
+	if fresh, exists := output.Metadata[s3MetaFresh]; exists {
+		if freshUntil, err := time.Parse(time.RFC3339, fresh); err == nil {
+			item.FreshUntil = freshUntil
+		}
+	}
+
+	if source, err := url.QueryUnescape(output.Metadata[s3MetaSource]); err == nil {
+		item.Source = source
+	}
+
+	if item.Expired(time.Now()) {
+		return nil, ErrItemNotExists
+	}
+
+	return item, nil
+}
+
+// Set uploads an item, keeping its metadata in object metadata.
+func (s *S3Cache) Set(key string, item *Item) error {
+	metadata := map[string]string{
+		s3MetaHash:    item.Hash,
+		s3MetaModTime: item.ModTime.UTC().Format(time.RFC3339),
+	}
+
+	if !item.ExpiresAt.IsZero() {
+		metadata[s3MetaExpires] = item.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	if !item.FreshUntil.IsZero() {
+		metadata[s3MetaFresh] = item.FreshUntil.UTC().Format(time.RFC3339)
+	}
+
+	// Metadata must be ASCII, so the source is escaped. Too long sources are left out of it,
+	// the index keeps them anyway.
+	if source := url.QueryEscape(item.Source); source != "" && len(source) <= s3MetaSourceLimit {
+		metadata[s3MetaSource] = source
+	}
+
+	_, err := s.uploader.Upload(context.Background(), &s3.PutObjectInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(s.objectKey(key)),
+		Body:     bytes.NewReader(item.Value),
+		Metadata: metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrS3Put, err)
+	}
+
+	if item.Source == "" {
+		return nil
+	}
+
+	// Every variant is indexed by an object of its own, so that replicas don't overwrite each other's index.
+	_, err = s.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.sourcePrefix(item.Source) + hashKey(key)),
+		Body:   strings.NewReader(key),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrS3Put, err)
+	}
+
+	return nil
+}
+
+// Clear removes every object under the cache prefix. It refuses to clear without a prefix,
+// since that would empty the whole bucket.
+func (s *S3Cache) Clear() {
+	if s.prefix == "" {
+		s.logger.Error(fmt.Errorf("%w: no prefix configured", ErrS3Clear))
+		return
+	}
+
+	// Index objects are under the cache prefix too.
+	keys, err := s.list(s.prefix)
+	if err == nil {
+		err = s.delete(keys)
+	}
+
+	if err != nil {
+		s.logger.Error(fmt.Errorf("%w: %s", ErrS3Clear, err))
+	}
+}
+
+// Variants returns keys of items derived from the source. Keys of expired items are returned too,
+// until lifecycle rules remove them along with their index objects.
+func (s *S3Cache) Variants(source string) []string {
+	objects, err := s.list(s.sourcePrefix(source))
+	if err != nil {
+		s.logger.Error(fmt.Errorf("%w: %s", ErrS3Get, err))
+		return nil
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		key, err := s.read(object)
+		if err != nil {
+			s.logger.Error(fmt.Errorf("%w: %s", ErrS3Get, err))
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// DeleteVariants removes items derived from the source along with their index objects,
+// returning count of indexed variants.
+func (s *S3Cache) DeleteVariants(source string) int {
+	keys := s.Variants(source)
+
+	objects := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		objects = append(objects, s.objectKey(key), s.sourcePrefix(source)+hashKey(key))
+	}
+
+	if err := s.delete(objects); err != nil {
+		s.logger.Error(fmt.Errorf("%w: %s", ErrS3Clear, err))
+		return 0
+	}
+
+	return len(keys)
+}
+
+// list returns keys of every object under the prefix.
+func (s *S3Cache) list(prefix string) ([]string, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	keys := make([]string, 0)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+	}
+
+	return keys, nil
+}
+
+// read returns the body of the object.
+func (s *S3Cache) read(key string) (string, error) {
+	output, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer output.Body.Close()
+
+	body, err := io.ReadAll(output.Body)
+
+	return string(body), err
+}
+
+// delete removes the objects, as many of them per request as S3 allows.
+func (s *S3Cache) delete(keys []string) error {
+	for len(keys) > 0 {
+		count := len(keys)
+		if count > s3DeleteLimit {
+			count = s3DeleteLimit
+		}
+
+		objects := make([]types.ObjectIdentifier, 0, count)
+		for _, key := range keys[:count] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		_, err := s.client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		keys = keys[count:]
+	}
+
+	return nil
+}
+
+// sourcePrefix returns the prefix of index objects of the source variants.
+func (s *S3Cache) sourcePrefix(source string) string {
+	return s.prefix + s3SourcesPrefix + hashKey(source) + "/"
+}
+
+// objectKey generates a fixed-length object key, since cache keys contain arbitrary URLs.
+func (s *S3Cache) objectKey(key string) string {
+	return s.prefix + hashKey(key)
+}
@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	internallogger "github.com/spendmail/previewer/internal/logger"
+	"github.com/stretchr/testify/require"
+)
+
+var errFakeS3Unsupported = errors.New("operation is not supported by fake s3")
+
+type fakeS3Object struct {
+	body     []byte
+	metadata map[string]string
+	modTime  time.Time
+}
+
+// fakeS3 is an in-process S3 stand-in, keeping objects of a single bucket in memory.
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string]fakeS3Object)}
+}
+
+func (f *fakeS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.objects[aws.ToString(params.Key)] = fakeS3Object{body, params.Metadata, time.Now()}
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	object, exists := f.objects[aws.ToString(params.Key)]
+	if !exists {
+		return nil, &types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{
+		Body:         ioutil.NopCloser(bytes.NewReader(object.body)),
+		Metadata:     object.metadata,
+		LastModified: aws.Time(object.modTime),
+	}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	contents := make([]types.Object, 0, len(keys))
+	for _, key := range keys {
+		contents = append(contents, types.Object{Key: aws.String(key)})
+	}
+
+	return &s3.ListObjectsV2Output{Contents: contents}, nil
+}
+
+func (f *fakeS3) DeleteObjects(_ context.Context, params *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, object := range params.Delete.Objects {
+		delete(f.objects, aws.ToString(object.Key))
+	}
+
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (f *fakeS3) UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return nil, errFakeS3Unsupported
+}
+
+func (f *fakeS3) CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errFakeS3Unsupported
+}
+
+func (f *fakeS3) CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errFakeS3Unsupported
+}
+
+func (f *fakeS3) AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errFakeS3Unsupported
+}
+
+func TestS3Cache(t *testing.T) {
+	config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := internallogger.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("set and get", func(t *testing.T) {
+		c := NewS3CacheWithClient(newFakeS3(), "previewer", "cache/", logger)
+
+		_, err := c.Get("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		item := NewItem([]byte("aaa"))
+		err = c.Set("aaa", item)
+		require.NoError(t, err)
+
+		val, err := c.Get("aaa")
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), val.Value)
+		require.Equal(t, item.Hash, val.Hash)
+		require.True(t, item.ModTime.Equal(val.ModTime))
+	})
+
+	t.Run("object keys", func(t *testing.T) {
+		client := newFakeS3()
+		c := NewS3CacheWithClient(client, "previewer", "cache/", logger)
+
+		err := c.Set("example.com/some/long/path/image.jpg-300-200", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		require.Len(t, client.objects, 1)
+		for key, object := range client.objects {
+			require.True(t, strings.HasPrefix(key, "cache/"))
+			require.NotContains(t, strings.TrimPrefix(key, "cache/"), "/")
+			// Metadata must be ASCII, so the key, which contains an arbitrary URL, isn't kept there.
+			require.NotContains(t, object.metadata, "key")
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		client := newFakeS3()
+		client.objects["foreign"] = fakeS3Object{body: []byte("foreign")}
+		c := NewS3CacheWithClient(client, "previewer", "cache/", logger)
+
+		err := c.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+		err = c.Set("bbb", NewItem([]byte("bbb")))
+		require.NoError(t, err)
+
+		c.Clear()
+
+		_, err = c.Get("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		_, err = c.Get("bbb")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		// Objects outside of the cache prefix must stay untouched.
+		require.Contains(t, client.objects, "foreign")
+	})
+
+	t.Run("source index", func(t *testing.T) {
+		client := newFakeS3()
+		c := NewS3CacheWithClient(client, "previewer", "cache/", logger)
+
+		for _, key := range []string{"пример.рф/a.jpg-1-1", "пример.рф/a.jpg-2-2", "пример.рф/b.jpg-1-1"} {
+			item := NewItem([]byte(key))
+			item.Source = strings.TrimSuffix(strings.TrimSuffix(key, "-1-1"), "-2-2")
+			require.NoError(t, c.Set(key, item))
+		}
+
+		// The source is escaped in metadata, since it must be ASCII.
+		val, err := c.Get("пример.рф/a.jpg-1-1")
+		require.NoError(t, err)
+		require.Equal(t, "пример.рф/a.jpg", val.Source)
+
+		// The index is kept in the bucket, so that it survives restarts.
+		c = NewS3CacheWithClient(client, "previewer", "cache/", logger)
+		require.ElementsMatch(t, []string{"пример.рф/a.jpg-1-1", "пример.рф/a.jpg-2-2"}, c.Variants("пример.рф/a.jpg"))
+
+		require.Equal(t, 2, c.DeleteVariants("пример.рф/a.jpg"))
+		require.Empty(t, c.Variants("пример.рф/a.jpg"))
+		require.Len(t, client.objects, 2)
+
+		c.Clear()
+		require.Empty(t, client.objects)
+	})
+
+	t.Run("clear without prefix", func(t *testing.T) {
+		client := newFakeS3()
+		client.objects["foreign"] = fakeS3Object{body: []byte("foreign")}
+		c := NewS3CacheWithClient(client, "previewer", "", logger)
+
+		err := c.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		// Clearing without a prefix would empty the whole bucket.
+		c.Clear()
+
+		require.Contains(t, client.objects, "foreign")
+		require.Len(t, client.objects, 2)
+	})
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"hash/fnv"
+)
+
+// ShardedCache partitions keys across independent LruCache segments sharing one directory,
+// so that concurrent requests for different keys rarely contend for the same mutex.
+type ShardedCache struct {
+	shards []*LruCache
+}
+
+// NewShardedCache is a sharded filesystem cache constructor: capacity is split evenly between shards.
+func NewShardedCache(config Config, logger Logger) (*ShardedCache, error) {
+	count := config.GetCacheShards()
+	capacity := (config.GetCacheCapacity() + int64(count) - 1) / int64(count)
+
+	cache := &ShardedCache{
+		shards: make([]*LruCache, count),
+	}
+
+	for i := range cache.shards {
+		shard, err := newLruCache(capacity, config.GetCachePath(), config.GetCachePolicy(), logger)
+		if err != nil {
+			return nil, err
+		}
+
+		cache.shards[i] = shard
+	}
+
+	// Directory is scanned once, restored items are distributed by their keys.
+	restored, err := cache.shards[0].prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([][]restoredItem, count)
+	for _, r := range restored {
+		i := cache.index(r.meta.Key)
+		partitions[i] = append(partitions[i], r)
+	}
+
+	for i, shard := range cache.shards {
+		shard.load(partitions[i])
+	}
+
+	return cache, nil
+}
+
+// Get returns item from the shard owning the key.
+func (s *ShardedCache) Get(key string) (*Item, error) {
+	return s.shard(key).Get(key)
+}
+
+// Set sets item to the shard owning the key.
+func (s *ShardedCache) Set(key string, item *Item) error {
+	return s.shard(key).Set(key, item)
+}
+
+// Clear clears every shard.
+func (s *ShardedCache) Clear() {
+	for _, shard := range s.shards {
+		shard.Clear()
+	}
+}
+
+// Delete removes the item from the shard owning the key.
+func (s *ShardedCache) Delete(key string) bool {
+	return s.shard(key).Delete(key)
+}
+
+// DeleteFunc removes matching items from every shard.
+func (s *ShardedCache) DeleteFunc(match func(key string) bool) int {
+	deleted := 0
+	for _, shard := range s.shards {
+		deleted += shard.DeleteFunc(match)
+	}
+
+	return deleted
+}
+
+// Variants returns keys of items derived from the source, they may be spread over every shard.
+func (s *ShardedCache) Variants(source string) []string {
+	keys := make([]string, 0)
+	for _, shard := range s.shards {
+		keys = append(keys, shard.Variants(source)...)
+	}
+
+	return keys
+}
+
+// DeleteVariants removes items derived from the source from every shard.
+func (s *ShardedCache) DeleteVariants(source string) int {
+	deleted := 0
+	for _, shard := range s.shards {
+		deleted += shard.DeleteVariants(source)
+	}
+
+	return deleted
+}
+
+// Entries returns descriptions of items of every shard.
+func (s *ShardedCache) Entries() []Entry {
+	entries := make([]Entry, 0)
+	for _, shard := range s.shards {
+		entries = append(entries, shard.Entries()...)
+	}
+
+	return entries
+}
+
+// RemoveExpired removes expired items from every shard.
+func (s *ShardedCache) RemoveExpired() int {
+	removed := 0
+	for _, shard := range s.shards {
+		removed += shard.RemoveExpired()
+	}
+
+	return removed
+}
+
+// Stats returns counters summed over all shards.
+func (s *ShardedCache) Stats() Stats {
+	var total Stats
+
+	for _, shard := range s.shards {
+		stats := shard.Stats()
+
+		total.Items += stats.Items
+		total.Bytes += stats.Bytes
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Evictions += stats.Evictions
+	}
+
+	return total
+}
+
+// shard returns the shard owning the key.
+func (s *ShardedCache) shard(key string) *LruCache {
+	return s.shards[s.index(key)]
+}
+
+// index maps the key to a shard index.
+func (s *ShardedCache) index(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
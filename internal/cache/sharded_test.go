@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedCache(t *testing.T) {
+	t.Run("stats", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.Capacity = 8
+		config.Cache.Shards = 4
+
+		c := newTestShardedCache(t, config)
+		require.Len(t, c.shards, 4)
+
+		for i := 0; i < 4; i++ {
+			key := strconv.Itoa(i)
+			err := c.Set(key, NewItem([]byte(key)))
+			require.NoError(t, err)
+		}
+
+		for i := 0; i < 6; i++ {
+			_, _ = c.Get(strconv.Itoa(i))
+		}
+
+		stats := c.Stats()
+		require.Equal(t, int64(4), stats.Items)
+		require.Equal(t, int64(4), stats.Bytes)
+		require.Equal(t, uint64(4), stats.Hits)
+		require.Equal(t, uint64(2), stats.Misses)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		config := newTestConfig(t)
+		config.Cache.Capacity = 64
+		config.Cache.Shards = 4
+
+		c := newTestShardedCache(t, config)
+
+		for i := 0; i < 16; i++ {
+			key := strconv.Itoa(i)
+			err := c.Set(key, NewItem([]byte(key)))
+			require.NoError(t, err)
+		}
+
+		// Every restored item must end up in the shard owning its key.
+		c = newTestShardedCache(t, config)
+		require.Equal(t, int64(16), c.Stats().Items)
+
+		for i := 0; i < 16; i++ {
+			key := strconv.Itoa(i)
+			val, err := c.Get(key)
+			require.NoError(t, err)
+			require.Equal(t, []byte(key), val.Value)
+		}
+	})
+}
+
+func newTestShardedCache(t *testing.T, config Config) *ShardedCache {
+	t.Helper()
+
+	c, err := NewShardedCache(config, newTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Opener is implemented by caches, which are able to stream items instead of reading them into memory.
+type Opener interface {
+	// Open returns the item without value along with a reader of the value, which must be closed.
+	Open(key string) (*Item, io.ReadSeekCloser, error)
+}
+
+// bytesReader reads a value, which is in memory already.
+type bytesReader struct {
+	*bytes.Reader
+}
+
+func newBytesReader(value []byte) bytesReader {
+	return bytesReader{bytes.NewReader(value)}
+}
+
+func (bytesReader) Close() error {
+	return nil
+}
+
+// Open returns the item file opened for reading. The file is checked to be of the stored size,
+// but unlike Get, not checksummed, since that would require reading it whole.
+// The file stays readable even if the item is replaced or evicted meanwhile.
+func (l *LruCache) Open(key string) (*Item, io.ReadSeekCloser, error) {
+	cacheItemElement, err := l.lookup(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(filepath.Join(l.path, cacheItemElement.value))
+	if err == nil {
+		err = checkSize(file, cacheItemElement.size)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+
+		l.evictIfUnchanged(cacheItemElement, err)
+		atomic.AddUint64(&l.stats.Misses, 1)
+
+		return nil, nil, fmt.Errorf("%w: %s", ErrItemNotExists, err)
+	}
+
+	atomic.AddUint64(&l.stats.Hits, 1)
+
+	return cacheItemElement.item(), file, nil
+}
+
+// checkSize checks that the file is of the size it was stored with.
+func checkSize(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != size {
+		return fmt.Errorf("%w: expected %d bytes, %d found", ErrItemCorrupted, size, info.Size())
+	}
+
+	return nil
+}
+
+// Open opens item from the shard owning the key.
+func (s *ShardedCache) Open(key string) (*Item, io.ReadSeekCloser, error) {
+	return s.shard(key).Open(key)
+}
+
+// Open looks item up in L1, then in L2. L2 items, which fit L1, are read and promoted as Get does,
+// larger ones are streamed from L2, if it supports that.
+func (t *TieredCache) Open(key string) (*Item, io.ReadSeekCloser, error) {
+	if item, err := t.l1.Get(key); err == nil {
+		atomic.AddUint64(&t.stats.L1Hits, 1)
+		return item, newBytesReader(item.Value), nil
+	}
+	atomic.AddUint64(&t.stats.L1Misses, 1)
+
+	item, reader, err := t.openL2(key)
+	if err != nil {
+		atomic.AddUint64(&t.stats.L2Misses, 1)
+		return nil, nil, err
+	}
+	atomic.AddUint64(&t.stats.L2Hits, 1)
+
+	return item, reader, nil
+}
+
+// openL2 opens item from L2, promoting it to L1 unless it is streamed.
+func (t *TieredCache) openL2(key string) (*Item, io.ReadSeekCloser, error) {
+	opener, ok := t.l2.(Opener)
+	if !ok {
+		item, err := t.l2.Get(key)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_ = t.l1.Set(key, item)
+
+		return item, newBytesReader(item.Value), nil
+	}
+
+	item, reader, err := opener.Open(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = reader.Seek(0, io.SeekStart)
+	}
+
+	// Items larger than the whole L1 budget wouldn't be stored there anyway.
+	if err == nil && size > t.l1.maxBytes {
+		return item, reader, nil
+	}
+
+	if err == nil {
+		item.Value, err = io.ReadAll(reader)
+	}
+
+	reader.Close()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrFileRead, err)
+	}
+
+	// Opener checks the size only, values read whole are checksummed before promoting, as Get does.
+	if err := verify(item.Value, size, item.Hash); err != nil {
+		if admin, ok := t.l2.(Admin); ok {
+			admin.Delete(key)
+		}
+
+		return nil, nil, fmt.Errorf("%w: %s", ErrItemNotExists, err)
+	}
+
+	// Promoting, memory cache never fails.
+	_ = t.l1.Set(key, item)
+
+	return item, newBytesReader(item.Value), nil
+}
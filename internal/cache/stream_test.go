@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readAll reads the whole reader and closes it.
+func readAll(t *testing.T, reader io.ReadCloser) []byte {
+	t.Helper()
+
+	defer reader.Close()
+
+	value, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	return value
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("filesystem", func(t *testing.T) {
+		config := newTestConfig(t)
+		c, err := NewLruCache(config, newTestLogger(t))
+		require.NoError(t, err)
+
+		_, _, err = c.Open("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		item := NewItem([]byte("aaa"))
+		item.Source = "example.com/a.jpg"
+		require.NoError(t, c.Set("aaa", item))
+
+		opened, reader, err := c.Open("aaa")
+		require.NoError(t, err)
+		require.Nil(t, opened.Value)
+		require.Equal(t, item.Hash, opened.Hash)
+		require.Equal(t, item.Source, opened.Source)
+
+		// The open file is still readable after the item is replaced.
+		require.NoError(t, c.Set("aaa", NewItem([]byte("bbbb"))))
+		require.Equal(t, []byte("aaa"), readAll(t, reader))
+
+		require.Equal(t, Stats{Items: 1, Bytes: 4, Hits: 1, Misses: 1}, c.Stats())
+	})
+
+	t.Run("truncated file", func(t *testing.T) {
+		config := newTestConfig(t)
+		c, err := NewLruCache(config, newTestLogger(t))
+		require.NoError(t, err)
+
+		require.NoError(t, c.Set("aaa", NewItem([]byte("aaa"))))
+		require.NoError(t, os.Truncate(filepath.Join(config.Cache.Path, encodeFileName("aaa", NewItem([]byte("aaa")).Hash)), 1))
+
+		_, _, err = c.Open("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		require.Equal(t, int64(0), c.Stats().Items)
+	})
+
+	t.Run("tiered", func(t *testing.T) {
+		config := newTestConfig(t)
+		l2, err := NewLruCache(config, newTestLogger(t))
+		require.NoError(t, err)
+
+		l1 := NewMemoryCache(3)
+		c := NewTieredCache(l1, l2)
+
+		require.NoError(t, l2.Set("aaa", NewItem([]byte("aaa"))))
+		require.NoError(t, l2.Set("bbb", NewItem([]byte("bbbb"))))
+
+		// Small items are promoted to L1.
+		_, reader, err := c.Open("aaa")
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), readAll(t, reader))
+
+		_, err = l1.Get("aaa")
+		require.NoError(t, err)
+
+		// Items larger than L1 are streamed from L2.
+		_, reader, err = c.Open("bbb")
+		require.NoError(t, err)
+		require.IsType(t, &os.File{}, reader)
+		require.Equal(t, []byte("bbbb"), readAll(t, reader))
+
+		_, reader, err = c.Open("aaa")
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), readAll(t, reader))
+
+		_, _, err = c.Open("ccc")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		require.Equal(t, TieredStats{L1Hits: 1, L1Misses: 3, L2Hits: 2, L2Misses: 1}, c.LevelStats())
+	})
+
+	t.Run("tiered corrupted file", func(t *testing.T) {
+		config := newTestConfig(t)
+		l2, err := NewLruCache(config, newTestLogger(t))
+		require.NoError(t, err)
+
+		l1 := NewMemoryCache(3)
+		c := NewTieredCache(l1, l2)
+
+		require.NoError(t, l2.Set("aaa", NewItem([]byte("aaa"))))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(config.Cache.Path, encodeFileName("aaa", NewItem([]byte("aaa")).Hash)), []byte("bbb"), 0o600))
+
+		// Corrupted value of the same size is neither served nor promoted, and is evicted from L2.
+		_, _, err = c.Open("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		_, err = l1.Get("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		require.Equal(t, int64(0), l2.Stats().Items)
+	})
+}
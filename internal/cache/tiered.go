@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// TieredCache is a two-level cache: a small in-memory L1 fronting a larger, slower L2.
+// Writes go to both levels, L2 hits are promoted to L1, and items evicted from L1 are
+// demoted, i.e. remain available in L2 only.
+type TieredCache struct {
+	l1    *MemoryCache
+	l2    Cache
+	stats TieredStats
+}
+
+// TieredStats holds hit and miss counters of each level.
+type TieredStats struct {
+	L1Hits   uint64
+	L1Misses uint64
+	L2Hits   uint64
+	L2Misses uint64
+}
+
+// NewTieredCache is a two-level cache constructor.
+func NewTieredCache(l1 *MemoryCache, l2 Cache) *TieredCache {
+	return &TieredCache{
+		l1: l1,
+		l2: l2,
+	}
+}
+
+// Get looks item up in L1, then in L2, promoting L2 hits to L1.
+func (t *TieredCache) Get(key string) (*Item, error) {
+	if item, err := t.l1.Get(key); err == nil {
+		atomic.AddUint64(&t.stats.L1Hits, 1)
+		return item, nil
+	}
+	atomic.AddUint64(&t.stats.L1Misses, 1)
+
+	item, err := t.l2.Get(key)
+	if err != nil {
+		atomic.AddUint64(&t.stats.L2Misses, 1)
+		return nil, err
+	}
+	atomic.AddUint64(&t.stats.L2Hits, 1)
+
+	// Promoting, memory cache never fails.
+	_ = t.l1.Set(key, item)
+
+	return item, nil
+}
+
+// Set writes item through both levels.
+func (t *TieredCache) Set(key string, item *Item) error {
+	if err := t.l2.Set(key, item); err != nil {
+		return err
+	}
+
+	return t.l1.Set(key, item)
+}
+
+// Clear clears both levels.
+func (t *TieredCache) Clear() {
+	t.l1.Clear()
+	t.l2.Clear()
+}
+
+// RemoveExpired removes expired items from L1, and from L2 unless it expires items by itself.
+func (t *TieredCache) RemoveExpired() int {
+	removed := t.l1.RemoveExpired()
+	if expirer, ok := t.l2.(Expirer); ok {
+		removed += expirer.RemoveExpired()
+	}
+
+	return removed
+}
+
+// Delete removes the item from both levels.
+func (t *TieredCache) Delete(key string) bool {
+	deleted := t.l1.Delete(key)
+	if admin, ok := t.l2.(Admin); ok {
+		deleted = admin.Delete(key) || deleted
+	}
+
+	return deleted
+}
+
+// DeleteFunc removes matching items from both levels, returning count of removed L2 items.
+// If L2 doesn't support management, only L1 items are removed and counted: see AdminOf.
+func (t *TieredCache) DeleteFunc(match func(key string) bool) int {
+	deleted := t.l1.DeleteFunc(match)
+	if admin, ok := t.l2.(Admin); ok {
+		deleted = admin.DeleteFunc(match)
+	}
+
+	return deleted
+}
+
+// Variants returns keys of items derived from the source, found in L2, or in L1 if L2 doesn't index them:
+// see SourceIndexerOf.
+func (t *TieredCache) Variants(source string) []string {
+	if indexer, ok := t.l2.(SourceIndexer); ok {
+		return indexer.Variants(source)
+	}
+
+	return t.l1.Variants(source)
+}
+
+// DeleteVariants removes items derived from the source from both levels, counting them like DeleteFunc does.
+// If L2 doesn't index items, only variants known to L1 are removed from it.
+func (t *TieredCache) DeleteVariants(source string) int {
+	if indexer, ok := t.l2.(SourceIndexer); ok {
+		// Items promoted from L2 may lack the source, so variants known to L2 are removed from L1 by keys.
+		for _, key := range indexer.Variants(source) {
+			t.l1.Delete(key)
+		}
+		t.l1.DeleteVariants(source)
+
+		return indexer.DeleteVariants(source)
+	}
+
+	keys := t.l1.Variants(source)
+	for _, key := range keys {
+		t.Delete(key)
+	}
+
+	return len(keys)
+}
+
+// Entries returns descriptions of L2 items, or of L1 ones if L2 doesn't support management: see AdminOf.
+func (t *TieredCache) Entries() []Entry {
+	if admin, ok := t.l2.(Admin); ok {
+		return admin.Entries()
+	}
+
+	return t.l1.Entries()
+}
+
+// Stats returns counters of the cache as a whole: a hit on any level is a hit, sizes are the ones of L2.
+func (t *TieredCache) Stats() Stats {
+	levels := t.LevelStats()
+
+	stats := Stats{
+		Hits:   levels.L1Hits + levels.L2Hits,
+		Misses: levels.L2Misses,
+	}
+
+	if admin, ok := t.l2.(Admin); ok {
+		l2 := admin.Stats()
+		stats.Items, stats.Bytes, stats.Evictions = l2.Items, l2.Bytes, l2.Evictions
+	}
+
+	return stats
+}
+
+// LevelStats returns a snapshot of hit and miss counters of each level.
+func (t *TieredCache) LevelStats() TieredStats {
+	return TieredStats{
+		L1Hits:   atomic.LoadUint64(&t.stats.L1Hits),
+		L1Misses: atomic.LoadUint64(&t.stats.L1Misses),
+		L2Hits:   atomic.LoadUint64(&t.stats.L2Hits),
+		L2Misses: atomic.LoadUint64(&t.stats.L2Misses),
+	}
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredCache(t *testing.T) {
+	t.Run("promotion", func(t *testing.T) {
+		l1 := NewMemoryCache(1024)
+		l2 := NewMemoryCache(1024)
+		c := NewTieredCache(l1, l2)
+
+		err := l2.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		val, err := c.Get("aaa")
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), val.Value)
+		require.Equal(t, TieredStats{L1Misses: 1, L2Hits: 1}, c.LevelStats())
+
+		// Item is promoted to L1 now.
+		_, err = l1.Get("aaa")
+		require.NoError(t, err)
+
+		_, err = c.Get("aaa")
+		require.NoError(t, err)
+		require.Equal(t, TieredStats{L1Hits: 1, L1Misses: 1, L2Hits: 1}, c.LevelStats())
+
+		_, err = c.Get("bbb")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+		require.Equal(t, TieredStats{L1Hits: 1, L1Misses: 2, L2Hits: 1, L2Misses: 1}, c.LevelStats())
+	})
+
+	t.Run("demotion", func(t *testing.T) {
+		l1 := NewMemoryCache(3)
+		l2 := NewMemoryCache(1024)
+		c := NewTieredCache(l1, l2)
+
+		err := c.Set("aaa", NewItem([]byte("aaa")))
+		require.NoError(t, err)
+
+		err = c.Set("bbb", NewItem([]byte("bbb")))
+		require.NoError(t, err)
+
+		// "aaa" doesn't fit into L1 anymore, but it is still in L2.
+		_, err = l1.Get("aaa")
+		require.Truef(t, errors.Is(err, ErrItemNotExists), "actual error %q", err)
+
+		val, err := c.Get("aaa")
+		require.NoError(t, err)
+		require.Equal(t, []byte("aaa"), val.Value)
+		require.Equal(t, TieredStats{L1Misses: 1, L2Hits: 1}, c.LevelStats())
+	})
+
+	t.Run("management", func(t *testing.T) {
+		_, ok := AdminOf(NewTieredCache(NewMemoryCache(3), NewMemoryCache(1024)))
+		require.True(t, ok)
+
+		_, ok = SourceIndexerOf(NewTieredCache(NewMemoryCache(3), NewMemoryCache(1024)))
+		require.True(t, ok)
+
+		// Managing L1 alone would miss items, which are in L2 only.
+		c := NewTieredCache(NewMemoryCache(3), NewS3CacheWithClient(newFakeS3(), "previewer", "cache/", newTestLogger(t)))
+
+		_, ok = AdminOf(c)
+		require.False(t, ok)
+
+		_, ok = SourceIndexerOf(c)
+		require.True(t, ok)
+	})
+}
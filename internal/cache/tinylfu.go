@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"hash/fnv"
+)
+
+const (
+	sketchDepth      = 4
+	sketchMaxCount   = 15
+	sketchSampleSize = 10
+	// tinyLFUWindowPercent and tinyLFUProtectedPercent size the segments as suggested by the W-TinyLFU paper.
+	tinyLFUWindowPercent    = 1
+	tinyLFUProtectedPercent = 80
+)
+
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+// TinyLFUPolicy is a W-TinyLFU policy: new keys enter a small LRU window, keys leaving the window
+// compete with the victim of the main segmented LRU and are admitted only if they are estimated
+// to be used more frequently. Frequencies are estimated by an aging count-min sketch, so that
+// a scan of one-off keys can't evict popular ones.
+type TinyLFUPolicy struct {
+	windowCapacity    int
+	protectedCapacity int
+	mainCapacity      int
+	window            List
+	probation         List
+	protected         List
+	items             map[string]*ListItem
+	sketch            *countMinSketch
+}
+
+type tinyLFUEntry struct {
+	key     string
+	segment int
+}
+
+// NewTinyLFUPolicy is a W-TinyLFU policy constructor.
+func NewTinyLFUPolicy(capacity int) *TinyLFUPolicy {
+	windowCapacity := capacity * tinyLFUWindowPercent / 100
+	if windowCapacity < 1 && capacity > 0 {
+		windowCapacity = 1
+	}
+
+	mainCapacity := capacity - windowCapacity
+	if mainCapacity < 0 {
+		mainCapacity = 0
+	}
+
+	return &TinyLFUPolicy{
+		windowCapacity:    windowCapacity,
+		protectedCapacity: mainCapacity * tinyLFUProtectedPercent / 100,
+		mainCapacity:      mainCapacity,
+		window:            NewList(),
+		probation:         NewList(),
+		protected:         NewList(),
+		items:             make(map[string]*ListItem, capacity),
+		sketch:            newCountMinSketch(capacity),
+	}
+}
+
+// Access counts the key and promotes it within its segment.
+func (p *TinyLFUPolicy) Access(key string) {
+	item, exists := p.items[key]
+	if !exists {
+		return
+	}
+
+	p.sketch.increment(key)
+
+	entry := item.Value.(*tinyLFUEntry)
+	switch entry.segment {
+	case segmentWindow:
+		p.window.MoveToFront(item)
+	case segmentProtected:
+		p.protected.MoveToFront(item)
+	case segmentProbation:
+		// Key used again while on probation becomes protected, the protected LRU is demoted if needed.
+		p.probation.Remove(item)
+		entry.segment = segmentProtected
+		p.items[key] = p.protected.PushFront(entry)
+
+		if p.protected.Len() > p.protectedCapacity {
+			demoted := p.protected.Back()
+			p.protected.Remove(demoted)
+
+			demotedEntry := demoted.Value.(*tinyLFUEntry)
+			demotedEntry.segment = segmentProbation
+			p.items[demotedEntry.key] = p.probation.PushFront(demotedEntry)
+		}
+	}
+}
+
+// Add puts key to the window, the window LRU then competes for a place in the main segment.
+func (p *TinyLFUPolicy) Add(key string) (bool, []string) {
+	if p.windowCapacity+p.mainCapacity <= 0 {
+		return false, nil
+	}
+
+	p.sketch.increment(key)
+	p.items[key] = p.window.PushFront(&tinyLFUEntry{key, segmentWindow})
+
+	if p.window.Len() <= p.windowCapacity {
+		return true, nil
+	}
+
+	candidateItem := p.window.Back()
+	p.window.Remove(candidateItem)
+	candidate := candidateItem.Value.(*tinyLFUEntry)
+
+	// Main segment has room, no competition is needed.
+	if p.probation.Len()+p.protected.Len() < p.mainCapacity {
+		candidate.segment = segmentProbation
+		p.items[candidate.key] = p.probation.PushFront(candidate)
+
+		return true, nil
+	}
+
+	victimItem := p.probation.Back()
+	victimList := p.probation
+	if victimItem == nil {
+		victimItem = p.protected.Back()
+		victimList = p.protected
+	}
+
+	// Candidate loses to the victim unless it is estimated to be used more often.
+	if victimItem == nil || p.sketch.estimate(candidate.key) <= p.sketch.estimate(victimItem.Value.(*tinyLFUEntry).key) {
+		delete(p.items, candidate.key)
+		return candidate.key != key, []string{candidate.key}
+	}
+
+	victim := victimItem.Value.(*tinyLFUEntry)
+	victimList.Remove(victimItem)
+	delete(p.items, victim.key)
+
+	candidate.segment = segmentProbation
+	p.items[candidate.key] = p.probation.PushFront(candidate)
+
+	return true, []string{victim.key}
+}
+
+// Remove forgets a key.
+func (p *TinyLFUPolicy) Remove(key string) {
+	item, exists := p.items[key]
+	if !exists {
+		return
+	}
+
+	switch item.Value.(*tinyLFUEntry).segment {
+	case segmentWindow:
+		p.window.Remove(item)
+	case segmentProbation:
+		p.probation.Remove(item)
+	case segmentProtected:
+		p.protected.Remove(item)
+	}
+
+	delete(p.items, key)
+}
+
+// Len returns count of keys.
+func (p *TinyLFUPolicy) Len() int {
+	return len(p.items)
+}
+
+// countMinSketch estimates key frequencies with 4-bit counters in a fixed memory.
+// Counters are halved once every sample, so that past popularity fades away.
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+
+	sketch := &countMinSketch{
+		mask:       uint64(width - 1),
+		sampleSize: sketchSampleSize * width,
+	}
+
+	for i := range sketch.rows {
+		sketch.rows[i] = make([]uint8, width)
+	}
+
+	return sketch
+}
+
+// increment counts the key, halving all counters once the sample is complete.
+func (s *countMinSketch) increment(key string) {
+	h1, h2 := sketchHashes(key)
+
+	for i := range s.rows {
+		index := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][index] < sketchMaxCount {
+			s.rows[i][index]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate returns the minimal counter of the key.
+func (s *countMinSketch) estimate(key string) uint8 {
+	h1, h2 := sketchHashes(key)
+
+	lowest := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if count := s.rows[i][(h1+uint64(i)*h2)&s.mask]; count < lowest {
+			lowest = count
+		}
+	}
+
+	return lowest
+}
+
+// reset halves all counters.
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+
+	s.additions /= 2
+}
+
+// sketchHashes derives two hashes of the key, row indexes are calculated by double hashing.
+func sketchHashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+
+	return sum, (sum >> 32) | 1
+}
@@ -1,18 +1,22 @@
 package config
 
 import (
-	"fmt"
+	"flag"
+	"time"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 )
 
 var ErrConfigRead = errors.New("unable to read config file")
 
 type Config struct {
-	Logger LoggerConf
-	HTTP   HTTPConf
-	Cache  CacheConf
+	Logger  LoggerConf
+	HTTP    HTTPConf
+	Admin   AdminConf
+	Origin  OriginConf
+	Health  HealthConf
+	Cache   CacheConf
+	Tracing TracingConf
 }
 
 type LoggerConf struct {
@@ -21,42 +25,164 @@ type LoggerConf struct {
 	Size    int
 	Backups int
 	Age     int
+	Console string
+	Format  string
+	Access  string
 }
 
 type HTTPConf struct {
-	Host string
-	Port string
+	Host   string
+	Port   string
+	MaxAge int
+}
+
+type AdminConf struct {
+	Host  string
+	Port  string
+	Token string
+}
+
+type OriginConf struct {
+	Timeout time.Duration
+	MaxSize int64
+}
+
+type HealthConf struct {
+	CanaryURL  string
+	Timeout    time.Duration
+	DrainDelay time.Duration
 }
 
 type CacheConf struct {
-	Capacity int64
-	Path     string
+	Capacity             int64
+	Path                 string
+	Shards               int
+	Policy               string
+	Backend              string
+	MemoryBytes          int64
+	TTL                  time.Duration
+	OriginTTL            bool
+	JanitorInterval      time.Duration
+	StaleWhileRevalidate time.Duration
+	MaxStale             time.Duration
+	S3                   S3Conf
+	Redis                RedisConf
 }
 
+type TracingConf struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64
+}
+
+type S3Conf struct {
+	Bucket    string
+	Prefix    string
+	Region    string
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+type RedisConf struct {
+	Address  string
+	Password string
+	DB       int
+	Prefix   string
+}
+
+// NewConfig reads configuration from the file, see Load.
 func NewConfig(path string) (*Config, error) {
-	viper.SetConfigFile(path)
+	return Load(path, nil)
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("%w: %s", ErrConfigRead, path)
+// Load reads configuration from the file, unless the path is empty, on top of built-in defaults,
+// overridden by PREVIEWER_* environment variables and then by the flags bound with BindFlags.
+// The configuration is validated, see Validate.
+func Load(path string, flags *flag.FlagSet) (*Config, error) {
+	settings, err := load(path, flags)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Config{
+	// Values of wrong types are reported along with invalid ones.
+	var v validator
+	r := reader{settings, &v}
+
+	config := &Config{
 		LoggerConf{
-			viper.GetString("logger.level"),
-			viper.GetString("logger.file"),
-			viper.GetInt("logger.size"),
-			viper.GetInt("logger.backups"),
-			viper.GetInt("logger.age"),
+			r.getString("logger.level"),
+			r.getString("logger.file"),
+			r.getInt("logger.size"),
+			r.getInt("logger.backups"),
+			r.getInt("logger.age"),
+			r.getString("logger.console"),
+			r.getString("logger.format"),
+			r.getString("logger.access"),
 		},
 		HTTPConf{
-			viper.GetString("http.host"),
-			viper.GetString("http.port"),
+			r.getString("http.host"),
+			r.getString("http.port"),
+			r.getInt("http.max_age"),
+		},
+		AdminConf{
+			r.getString("admin.host"),
+			r.getString("admin.port"),
+			r.getString("admin.token"),
+		},
+		OriginConf{
+			r.getDuration("origin.timeout"),
+			r.getInt64("origin.max_size"),
+		},
+		HealthConf{
+			r.getString("health.canary_url"),
+			r.getDuration("health.timeout"),
+			r.getDuration("health.drain_delay"),
 		},
 		CacheConf{
-			viper.GetInt64("cache.capacity"),
-			viper.GetString("cache.path"),
+			r.getInt64("cache.capacity"),
+			r.getString("cache.path"),
+			r.getInt("cache.shards"),
+			r.getString("cache.policy"),
+			r.getString("cache.backend"),
+			r.getInt64("cache.memory_bytes"),
+			r.getDuration("cache.ttl"),
+			r.getBool("cache.origin_ttl"),
+			r.getDuration("cache.janitor_interval"),
+			r.getDuration("cache.stale_while_revalidate"),
+			r.getDuration("cache.max_stale"),
+			S3Conf{
+				r.getString("cache.s3.bucket"),
+				r.getString("cache.s3.prefix"),
+				r.getString("cache.s3.region"),
+				r.getString("cache.s3.endpoint"),
+				r.getString("cache.s3.access_key"),
+				r.getString("cache.s3.secret_key"),
+				r.getBool("cache.s3.path_style"),
+			},
+			RedisConf{
+				r.getString("cache.redis.address"),
+				r.getString("cache.redis.password"),
+				r.getInt("cache.redis.db"),
+				r.getString("cache.redis.prefix"),
+			},
+		},
+		TracingConf{
+			r.getString("tracing.exporter"),
+			r.getString("tracing.endpoint"),
+			r.getBool("tracing.insecure"),
+			r.getFloat64("tracing.sample_ratio"),
 		},
-	}, nil
+	}
+
+	config.validate(&v)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
 }
 
 func (c *Config) GetLoggerLevel() string {
@@ -67,6 +193,30 @@ func (c *Config) GetLoggerFile() string {
 	return c.Logger.File
 }
 
+func (c *Config) GetLoggerSize() int {
+	return c.Logger.Size
+}
+
+func (c *Config) GetLoggerBackups() int {
+	return c.Logger.Backups
+}
+
+func (c *Config) GetLoggerAge() int {
+	return c.Logger.Age
+}
+
+func (c *Config) GetLoggerConsole() string {
+	return c.Logger.Console
+}
+
+func (c *Config) GetLoggerFormat() string {
+	return c.Logger.Format
+}
+
+func (c *Config) GetLoggerAccess() string {
+	return c.Logger.Access
+}
+
 func (c *Config) GetHTTPHost() string {
 	return c.HTTP.Host
 }
@@ -75,6 +225,42 @@ func (c *Config) GetHTTPPort() string {
 	return c.HTTP.Port
 }
 
+func (c *Config) GetHTTPMaxAge() int {
+	return c.HTTP.MaxAge
+}
+
+func (c *Config) GetAdminHost() string {
+	return c.Admin.Host
+}
+
+func (c *Config) GetAdminPort() string {
+	return c.Admin.Port
+}
+
+func (c *Config) GetAdminToken() string {
+	return c.Admin.Token
+}
+
+func (c *Config) GetOriginTimeout() time.Duration {
+	return c.Origin.Timeout
+}
+
+func (c *Config) GetOriginMaxSize() int64 {
+	return c.Origin.MaxSize
+}
+
+func (c *Config) GetHealthCanaryURL() string {
+	return c.Health.CanaryURL
+}
+
+func (c *Config) GetHealthTimeout() time.Duration {
+	return c.Health.Timeout
+}
+
+func (c *Config) GetHealthDrainDelay() time.Duration {
+	return c.Health.DrainDelay
+}
+
 func (c *Config) GetCacheCapacity() int64 {
 	return c.Cache.Capacity
 }
@@ -82,3 +268,99 @@ func (c *Config) GetCacheCapacity() int64 {
 func (c *Config) GetCachePath() string {
 	return c.Cache.Path
 }
+
+func (c *Config) GetCacheShards() int {
+	return c.Cache.Shards
+}
+
+func (c *Config) GetCachePolicy() string {
+	return c.Cache.Policy
+}
+
+func (c *Config) GetCacheBackend() string {
+	return c.Cache.Backend
+}
+
+func (c *Config) GetCacheMemoryBytes() int64 {
+	return c.Cache.MemoryBytes
+}
+
+func (c *Config) GetCacheTTL() time.Duration {
+	return c.Cache.TTL
+}
+
+func (c *Config) GetCacheOriginTTL() bool {
+	return c.Cache.OriginTTL
+}
+
+func (c *Config) GetCacheJanitorInterval() time.Duration {
+	return c.Cache.JanitorInterval
+}
+
+func (c *Config) GetCacheStaleWhileRevalidate() time.Duration {
+	return c.Cache.StaleWhileRevalidate
+}
+
+func (c *Config) GetCacheMaxStale() time.Duration {
+	return c.Cache.MaxStale
+}
+
+func (c *Config) GetCacheS3Bucket() string {
+	return c.Cache.S3.Bucket
+}
+
+func (c *Config) GetCacheS3Prefix() string {
+	return c.Cache.S3.Prefix
+}
+
+func (c *Config) GetCacheS3Region() string {
+	return c.Cache.S3.Region
+}
+
+func (c *Config) GetCacheS3Endpoint() string {
+	return c.Cache.S3.Endpoint
+}
+
+func (c *Config) GetCacheS3AccessKey() string {
+	return c.Cache.S3.AccessKey
+}
+
+func (c *Config) GetCacheS3SecretKey() string {
+	return c.Cache.S3.SecretKey
+}
+
+func (c *Config) GetCacheS3PathStyle() bool {
+	return c.Cache.S3.PathStyle
+}
+
+func (c *Config) GetCacheRedisAddress() string {
+	return c.Cache.Redis.Address
+}
+
+func (c *Config) GetCacheRedisPassword() string {
+	return c.Cache.Redis.Password
+}
+
+func (c *Config) GetCacheRedisDB() int {
+	return c.Cache.Redis.DB
+}
+
+func (c *Config) GetCacheRedisPrefix() string {
+	return c.Cache.Redis.Prefix
+}
+
+func (c *Config) GetTracingExporter() string {
+	return c.Tracing.Exporter
+}
+
+func (c *Config) GetTracingEndpoint() string {
+	return c.Tracing.Endpoint
+}
+
+func (c *Config) GetTracingInsecure() bool {
+	return c.Tracing.Insecure
+}
+
+func (c *Config) GetTracingSampleRatio() float64 {
+	return c.Tracing.SampleRatio
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"bytes"
+	"flag"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -11,4 +14,146 @@ func TestConfig(t *testing.T) {
 		_, err := NewConfig("/very/wrong/path.conf")
 		require.ErrorIs(t, err, ErrConfigRead, "Error must be: %q, actual: %q", ErrConfigRead, err)
 	})
+
+	t.Run("defaults", func(t *testing.T) {
+		config, err := Load("", nil)
+		require.NoError(t, err)
+		require.Equal(t, "8888", config.GetHTTPPort())
+		require.Equal(t, int64(1000), config.GetCacheCapacity())
+		require.Equal(t, 24*time.Hour, config.GetCacheTTL())
+		require.Equal(t, 1.0, config.GetTracingSampleRatio())
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("PREVIEWER_HTTP_PORT", "9000")
+		t.Setenv("PREVIEWER_CACHE_S3_BUCKET", "images")
+		t.Setenv("PREVIEWER_CACHE_TTL", "1h")
+		t.Setenv("PREVIEWER_CACHE_CAPACITY", "10")
+		t.Setenv("PREVIEWER_LOGGER_FILE", "")
+		t.Setenv("PREVIEWER_LOGGER_CONSOLE", "stderr")
+
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		BindFlags(flags)
+		require.NoError(t, flags.Parse([]string{"-cache.capacity", "20", "-cache.origin_ttl", "true"}))
+
+		config, err := Load("../../configs/previewer.toml", flags)
+		require.NoError(t, err)
+
+		// Environment takes precedence over the file.
+		require.Equal(t, "9000", config.GetHTTPPort())
+		require.Equal(t, "images", config.GetCacheS3Bucket())
+		require.Equal(t, time.Hour, config.GetCacheTTL())
+		require.Empty(t, config.GetLoggerFile())
+		require.Equal(t, "stderr", config.GetLoggerConsole())
+
+		// Flags take precedence over environment.
+		require.Equal(t, int64(20), config.GetCacheCapacity())
+		require.True(t, config.GetCacheOriginTTL())
+
+		// The rest comes from the file.
+		require.Equal(t, "debug", config.GetLoggerLevel())
+	})
+
+	t.Run("print", func(t *testing.T) {
+		t.Setenv("PREVIEWER_ADMIN_TOKEN", "s3cr3t")
+
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		BindFlags(flags)
+		require.NoError(t, flags.Parse([]string{"-http.max_age", "60"}))
+
+		var buffer bytes.Buffer
+		require.NoError(t, Print(&buffer, "../../configs/previewer.toml", flags))
+
+		printed := buffer.String()
+		require.Contains(t, printed, `level = "debug"`)
+		require.Contains(t, printed, "max_age = 60")
+		require.Contains(t, printed, `ttl = "24h0m0s"`)
+		require.Contains(t, printed, `token = "********"`)
+		require.NotContains(t, printed, "s3cr3t")
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		config, err := NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+		require.NoError(t, config.Validate())
+
+		for key, invalidate := range map[string]func(c *Config){
+			"logger.level":                 func(c *Config) { c.Logger.Level = "loud" },
+			"logger.format":                func(c *Config) { c.Logger.Format = "xml" },
+			"logger.access":                func(c *Config) { c.Logger.Access = c.Logger.File },
+			"logger.console":               func(c *Config) { c.Logger.Console = "tty" },
+			"logger.file":                  func(c *Config) { c.Logger.File, c.Logger.Console = "", "" },
+			"logger.size":                  func(c *Config) { c.Logger.Size = -1 },
+			"logger.backups":               func(c *Config) { c.Logger.Backups = -1 },
+			"logger.age":                   func(c *Config) { c.Logger.Age = -1 },
+			"http.port":                    func(c *Config) { c.HTTP.Port = "http" },
+			"http.max_age":                 func(c *Config) { c.HTTP.MaxAge = -1 },
+			"admin.port":                   func(c *Config) { c.Admin.Port = "65536" },
+			"origin.timeout":               func(c *Config) { c.Origin.Timeout = -time.Second },
+			"origin.max_size":              func(c *Config) { c.Origin.MaxSize = -1 },
+			"health.timeout":               func(c *Config) { c.Health.Timeout = -time.Second },
+			"health.drain_delay":           func(c *Config) { c.Health.DrainDelay = -time.Second },
+			"cache.capacity":               func(c *Config) { c.Cache.Capacity = -1 },
+			"cache.path":                   func(c *Config) { c.Cache.Path = "" },
+			"cache.shards":                 func(c *Config) { c.Cache.Shards = -1 },
+			"cache.policy":                 func(c *Config) { c.Cache.Policy = "fifo" },
+			"cache.backend":                func(c *Config) { c.Cache.Backend = "disk" },
+			"cache.memory_bytes":           func(c *Config) { c.Cache.Backend, c.Cache.MemoryBytes = "memory", 0 },
+			"cache.ttl":                    func(c *Config) { c.Cache.TTL = -time.Second },
+			"cache.janitor_interval":       func(c *Config) { c.Cache.JanitorInterval = -time.Second },
+			"cache.stale_while_revalidate": func(c *Config) { c.Cache.StaleWhileRevalidate = -time.Second },
+			"cache.max_stale":              func(c *Config) { c.Cache.MaxStale = -time.Second },
+			"cache.s3.bucket":              func(c *Config) { c.Cache.Backend, c.Cache.S3.Bucket = "s3", "" },
+			"cache.s3.region":              func(c *Config) { c.Cache.Backend, c.Cache.S3.Region = "s3", "" },
+			"cache.s3.prefix":              func(c *Config) { c.Cache.Backend, c.Cache.S3.Prefix = "s3", "" },
+			"cache.redis.address":          func(c *Config) { c.Cache.Backend, c.Cache.Redis.Address = "redis", "" },
+			"cache.redis.db":               func(c *Config) { c.Cache.Backend, c.Cache.Redis.DB = "redis", -1 },
+			"cache.redis.prefix":           func(c *Config) { c.Cache.Backend, c.Cache.Redis.Prefix = "redis", "" },
+			"tracing.exporter":             func(c *Config) { c.Tracing.Exporter = "jaeger" },
+			"tracing.endpoint":             func(c *Config) { c.Tracing.Exporter, c.Tracing.Endpoint = "otlp", "" },
+			"tracing.sample_ratio":         func(c *Config) { c.Tracing.SampleRatio = 1.5 },
+		} {
+			invalid := *config
+			invalidate(&invalid)
+
+			var validationError *ValidationError
+			require.ErrorAs(t, invalid.Validate(), &validationError, key)
+			require.Len(t, validationError.Problems, 1, key)
+			require.Equal(t, key, validationError.Problems[0].Key)
+		}
+	})
+
+	t.Run("all problems", func(t *testing.T) {
+		t.Setenv("PREVIEWER_LOGGER_LEVEL", "loud")
+		t.Setenv("PREVIEWER_CACHE_CAPACITY", "-1")
+		t.Setenv("PREVIEWER_CACHE_PATH", "")
+
+		_, err := Load("../../configs/previewer.toml", nil)
+		require.ErrorIs(t, err, ErrConfigInvalid)
+		require.EqualError(t, err, `invalid configuration: logger.level: must be one of ["debug" "info" "warn" "error"], "loud" given; `+
+			"cache.capacity: must not be negative, -1 given; cache.path: must not be empty")
+	})
+
+	t.Run("unparsable values", func(t *testing.T) {
+		t.Setenv("PREVIEWER_CACHE_CAPACITY", "abc")
+		t.Setenv("PREVIEWER_CACHE_TTL", "ten minutes")
+		t.Setenv("PREVIEWER_CACHE_MEMORY_BYTES", "-")
+
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		BindFlags(flags)
+		require.NoError(t, flags.Parse([]string{"-cache.origin_ttl", "maybe", "-tracing.sample_ratio", "half", "-logger.size", "1.5"}))
+
+		_, err := Load("../../configs/previewer.toml", flags)
+
+		var validationError *ValidationError
+		require.ErrorAs(t, err, &validationError)
+		require.ElementsMatch(t, []Problem{
+			{"logger.size", `must be an integer, "1.5" given`},
+			{"cache.capacity", `must be an integer, "abc" given`},
+			{"cache.memory_bytes", `must be an integer, "-" given`},
+			{"cache.ttl", `must be a duration such as "10s", "ten minutes" given`},
+			{"cache.origin_ttl", `must be a boolean, "maybe" given`},
+			{"tracing.sample_ratio", `must be a number, "half" given`},
+		}, validationError.Problems)
+	})
 }
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is a prefix of environment variables overriding keys, e.g. PREVIEWER_HTTP_PORT overrides http.port.
+const EnvPrefix = "PREVIEWER"
+
+// maskedValue replaces secrets in printed configuration.
+const maskedValue = "********"
+
+// defaults are built-in values of every key, which are used unless the file or overrides set them.
+var defaults = map[string]interface{}{
+	"logger.level":   "info",
+	"logger.file":    "",
+	"logger.size":    100,
+	"logger.backups": 5,
+	"logger.age":     30,
+	"logger.console": "stdout",
+	"logger.format":  "json",
+	"logger.access":  "",
+
+	"http.host":    "0.0.0.0",
+	"http.port":    "8888",
+	"http.max_age": 86400,
+
+	"admin.host":  "127.0.0.1",
+	"admin.port":  "8889",
+	"admin.token": "",
+
+	"origin.timeout":  10 * time.Second,
+	"origin.max_size": int64(50 << 20),
+
+	"health.canary_url":  "",
+	"health.timeout":     2 * time.Second,
+	"health.drain_delay": 5 * time.Second,
+
+	"cache.capacity":               int64(1000),
+	"cache.path":                   "/tmp/cache",
+	"cache.shards":                 1,
+	"cache.policy":                 "lru",
+	"cache.backend":                "filesystem",
+	"cache.memory_bytes":           int64(64 << 20),
+	"cache.ttl":                    24 * time.Hour,
+	"cache.origin_ttl":             false,
+	"cache.janitor_interval":       time.Minute,
+	"cache.stale_while_revalidate": time.Minute,
+	"cache.max_stale":              24 * time.Hour,
+
+	"cache.s3.bucket":     "previewer",
+	"cache.s3.prefix":     "cache/",
+	"cache.s3.region":     "us-east-1",
+	"cache.s3.endpoint":   "",
+	"cache.s3.access_key": "",
+	"cache.s3.secret_key": "",
+	"cache.s3.path_style": false,
+
+	"cache.redis.address":  "localhost:6379",
+	"cache.redis.password": "",
+	"cache.redis.db":       0,
+	"cache.redis.prefix":   "previewer:",
+
+	"tracing.exporter":     "none",
+	"tracing.endpoint":     "localhost:4318",
+	"tracing.insecure":     true,
+	"tracing.sample_ratio": 1.0,
+}
+
+// secrets are keys, which values are masked when printed.
+var secrets = map[string]bool{
+	"admin.token":          true,
+	"cache.s3.access_key":  true,
+	"cache.s3.secret_key":  true,
+	"cache.redis.password": true,
+}
+
+// BindFlags defines a flag per key on the flag set, e.g. -http.port, to be passed to Load once parsed.
+func BindFlags(flags *flag.FlagSet) {
+	for key := range defaults {
+		flags.String(key, "", fmt.Sprintf("Overrides %s, also set by %s", key, envName(key)))
+	}
+}
+
+// load reads the file, unless the path is empty, on top of built-in defaults. Environment variables
+// take precedence over the file, and flags, which are set, take precedence over everything.
+func load(path string, flags *flag.FlagSet) (*viper.Viper, error) {
+	v := viper.New()
+
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	if path != "" {
+		v.SetConfigFile(path)
+
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrConfigRead, path)
+		}
+	}
+
+	// Empty variables are honored, e.g. PREVIEWER_LOGGER_FILE= disables the log file.
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AllowEmptyEnv(true)
+	v.AutomaticEnv()
+
+	if flags != nil {
+		flags.Visit(func(f *flag.Flag) {
+			if _, ok := defaults[f.Name]; ok {
+				v.Set(f.Name, f.Value.String())
+			}
+		})
+	}
+
+	return v, nil
+}
+
+// reader reads values of keys, reporting values, which can't be parsed as the type of the key.
+type reader struct {
+	settings  *viper.Viper
+	validator *validator
+}
+
+func (r reader) getString(key string) string {
+	value, err := cast.ToStringE(r.settings.Get(key))
+	r.validator.check(err == nil, key, "must be a string, \"%v\" given", r.settings.Get(key))
+
+	return value
+}
+
+func (r reader) getInt(key string) int {
+	value, err := cast.ToIntE(r.settings.Get(key))
+	r.validator.check(err == nil, key, "must be an integer, \"%v\" given", r.settings.Get(key))
+
+	return value
+}
+
+func (r reader) getInt64(key string) int64 {
+	value, err := cast.ToInt64E(r.settings.Get(key))
+	r.validator.check(err == nil, key, "must be an integer, \"%v\" given", r.settings.Get(key))
+
+	return value
+}
+
+func (r reader) getBool(key string) bool {
+	value, err := cast.ToBoolE(r.settings.Get(key))
+	r.validator.check(err == nil, key, "must be a boolean, \"%v\" given", r.settings.Get(key))
+
+	return value
+}
+
+func (r reader) getFloat64(key string) float64 {
+	value, err := cast.ToFloat64E(r.settings.Get(key))
+	r.validator.check(err == nil, key, "must be a number, \"%v\" given", r.settings.Get(key))
+
+	return value
+}
+
+func (r reader) getDuration(key string) time.Duration {
+	value, err := cast.ToDurationE(r.settings.Get(key))
+	r.validator.check(err == nil, key, "must be a duration such as \"10s\", \"%v\" given", r.settings.Get(key))
+
+	return value
+}
+
+// envName returns the name of the environment variable overriding the key.
+func envName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Print writes the effective configuration as TOML, secrets are masked.
+func Print(w io.Writer, path string, flags *flag.FlagSet) error {
+	v, err := load(path, flags)
+	if err != nil {
+		return err
+	}
+
+	tree, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+
+	for key, value := range defaults {
+		// Values are read by the type of defaults, as they are read by Load, since overrides are strings.
+		switch value.(type) {
+		case string:
+			tree.Set(key, v.GetString(key))
+		case int, int64:
+			tree.Set(key, v.GetInt64(key))
+		case bool:
+			tree.Set(key, v.GetBool(key))
+		case float64:
+			tree.Set(key, v.GetFloat64(key))
+		case time.Duration:
+			tree.Set(key, v.GetDuration(key).String())
+		}
+
+		if secrets[key] && v.GetString(key) != "" {
+			tree.Set(key, maskedValue)
+		}
+	}
+
+	_, err = tree.WriteTo(w)
+
+	return err
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrConfigInvalid = errors.New("invalid configuration")
+
+// Problem is an invalid value of a key.
+type Problem struct {
+	Key     string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Key + ": " + p.Message
+}
+
+// ValidationError lists every problem of the configuration, it wraps ErrConfigInvalid.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		problems = append(problems, problem.String())
+	}
+
+	return fmt.Sprintf("%s: %s", ErrConfigInvalid, strings.Join(problems, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrConfigInvalid
+}
+
+// validator collects problems found by checks.
+type validator struct {
+	problems []Problem
+}
+
+// check adds the problem unless the condition holds. A key gets one problem at most, so that
+// a value, which couldn't be parsed, isn't reported again as its zero value.
+func (v *validator) check(ok bool, key, format string, args ...interface{}) {
+	if ok {
+		return
+	}
+
+	for _, problem := range v.problems {
+		if problem.Key == key {
+			return
+		}
+	}
+
+	v.problems = append(v.problems, Problem{key, fmt.Sprintf(format, args...)})
+}
+
+// err returns a ValidationError listing the problems, if there are any.
+func (v *validator) err() error {
+	if len(v.problems) > 0 {
+		return &ValidationError{v.problems}
+	}
+
+	return nil
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+
+	v.check(false, key, "must be one of %q, %q given", allowed, value)
+}
+
+func (v *validator) notNegative(key string, value int64) {
+	v.check(value >= 0, key, "must not be negative, %d given", value)
+}
+
+func (v *validator) notNegativeDuration(key string, value time.Duration) {
+	v.check(value >= 0, key, "must not be negative, %s given", value)
+}
+
+func (v *validator) notEmpty(key, value string) {
+	v.check(value != "", key, "must not be empty")
+}
+
+func (v *validator) port(key, value string) {
+	port, err := strconv.Atoi(value)
+	v.check(err == nil && port > 0 && port <= 65535, key, "must be a port number, %q given", value)
+}
+
+// Validate checks values of every key, returning a ValidationError listing all problems at once.
+func (c *Config) Validate() error {
+	var v validator
+	c.validate(&v)
+
+	return v.err()
+}
+
+func (c *Config) validate(v *validator) {
+	v.oneOf("logger.level", c.Logger.Level, "debug", "info", "warn", "error")
+	v.oneOf("logger.format", c.Logger.Format, "", "text", "json")
+	v.oneOf("logger.console", c.Logger.Console, "", "stdout", "stderr")
+	v.check(c.Logger.File != "" || c.Logger.Console != "", "logger.file", "must not be empty unless logger.console is set")
+	v.notNegative("logger.size", int64(c.Logger.Size))
+	v.notNegative("logger.backups", int64(c.Logger.Backups))
+	v.notNegative("logger.age", int64(c.Logger.Age))
+	v.check(c.Logger.Access == "" || c.Logger.Access != c.Logger.File, "logger.access", "must differ from logger.file")
+
+	v.port("http.port", c.HTTP.Port)
+	v.notNegative("http.max_age", int64(c.HTTP.MaxAge))
+	v.port("admin.port", c.Admin.Port)
+
+	v.notNegativeDuration("origin.timeout", c.Origin.Timeout)
+	v.notNegative("origin.max_size", c.Origin.MaxSize)
+
+	v.notNegativeDuration("health.timeout", c.Health.Timeout)
+	v.notNegativeDuration("health.drain_delay", c.Health.DrainDelay)
+
+	v.notNegative("cache.capacity", c.Cache.Capacity)
+	v.notNegative("cache.shards", int64(c.Cache.Shards))
+	v.oneOf("cache.policy", c.Cache.Policy, "", "lru", "lfu", "tinylfu", "arc")
+	v.oneOf("cache.backend", c.Cache.Backend, "", "filesystem", "memory", "s3", "redis")
+	v.notNegative("cache.memory_bytes", c.Cache.MemoryBytes)
+	v.notNegativeDuration("cache.ttl", c.Cache.TTL)
+	v.notNegativeDuration("cache.janitor_interval", c.Cache.JanitorInterval)
+	v.notNegativeDuration("cache.stale_while_revalidate", c.Cache.StaleWhileRevalidate)
+	v.notNegativeDuration("cache.max_stale", c.Cache.MaxStale)
+
+	// Settings of a backend are checked only if it is used.
+	switch c.Cache.Backend {
+	case "filesystem", "":
+		v.notEmpty("cache.path", c.Cache.Path)
+	case "memory":
+		v.check(c.Cache.MemoryBytes > 0, "cache.memory_bytes", "must be positive for the memory backend, %d given", c.Cache.MemoryBytes)
+	case "s3":
+		v.notEmpty("cache.s3.bucket", c.Cache.S3.Bucket)
+		v.notEmpty("cache.s3.region", c.Cache.S3.Region)
+		// Objects of the cache are told from foreign ones by the prefix, clearing the cache relies on it.
+		v.notEmpty("cache.s3.prefix", c.Cache.S3.Prefix)
+	case "redis":
+		v.notEmpty("cache.redis.address", c.Cache.Redis.Address)
+		v.notNegative("cache.redis.db", int64(c.Cache.Redis.DB))
+		// Keys of the cache are told from foreign ones by the prefix, clearing the cache relies on it.
+		v.notEmpty("cache.redis.prefix", c.Cache.Redis.Prefix)
+	}
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "", "none", "stdout", "otlp")
+	if c.Tracing.Exporter == "otlp" {
+		v.notEmpty("tracing.endpoint", c.Tracing.Endpoint)
+	}
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio",
+		"must be between 0 and 1, %g given", c.Tracing.SampleRatio)
+}
@@ -1,8 +1,9 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -13,30 +14,85 @@ const (
 	INFO  = "info"
 	WARN  = "warn"
 	ERROR = "error"
+
+	FormatText = "text"
+	FormatJSON = "json"
+
+	// RequestIDField is the field, which carries the ID of the request being served.
+	RequestIDField = "request_id"
 )
 
 type Config interface {
 	GetLoggerLevel() string
 	GetLoggerFile() string
+	GetLoggerSize() int
+	GetLoggerBackups() int
+	GetLoggerAge() int
+	GetLoggerConsole() string
+	GetLoggerFormat() string
+	GetLoggerAccess() string
 }
 
 type Logger struct {
 	Logger *logrus.Logger
+	// file is nil unless logs are written to a file.
+	file fileSink
+	// access writes access log lines as JSON regardless of the level and the format of the log.
+	access *logrus.Logger
+	// accessFile is nil unless access log lines are written to a file of their own.
+	accessFile fileSink
 }
 
-var ErrLogFileOpen = errors.New("unable to open a log file")
+var (
+	ErrLogFileOpen = errors.New("unable to open a log file")
+	ErrLogFormat   = errors.New("unknown log format")
+	ErrLogSink     = errors.New("unknown log sink")
+	ErrNoLogSinks  = errors.New("neither log file nor console is configured")
+)
+
+type requestIDKey struct{}
 
-// New is a logger constructor.
+// New is a logger constructor: logs are written to the file, the console or both of them.
 func New(config Config) (*Logger, error) {
 	logger := logrus.New()
-	logger.Formatter = &logrus.TextFormatter{}
 
-	file, err := os.OpenFile(config.GetLoggerFile(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o666)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %s", ErrLogFileOpen, config.GetLoggerFile())
+	switch config.GetLoggerFormat() {
+	case FormatText, "":
+		logger.Formatter = &logrus.TextFormatter{}
+	case FormatJSON:
+		logger.Formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrLogFormat, config.GetLoggerFormat())
+	}
+
+	sinks := make([]io.Writer, 0, 2)
+
+	var file fileSink
+	if config.GetLoggerFile() != "" {
+		var err error
+		file, err = newFileSink(config.GetLoggerFile(), config.GetLoggerSize(), config.GetLoggerBackups(), config.GetLoggerAge())
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, file)
+	}
+
+	if config.GetLoggerConsole() != "" {
+		console, err := newConsoleSink(config.GetLoggerConsole())
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, console)
+	}
+
+	if len(sinks) == 0 {
+		return nil, ErrNoLogSinks
 	}
 
-	logger.SetOutput(file)
+	output := io.MultiWriter(sinks...)
+	logger.SetOutput(output)
 
 	switch config.GetLoggerLevel() {
 	case DEBUG:
@@ -49,11 +105,81 @@ func New(config Config) (*Logger, error) {
 		logger.SetLevel(logrus.ErrorLevel)
 	}
 
+	access, accessFile, err := newAccessLogger(config, output)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Logger{
-		Logger: logger,
+		Logger:     logger,
+		file:       file,
+		access:     access,
+		accessFile: accessFile,
 	}, nil
 }
 
+// newAccessLogger returns a logger of access log lines, which are written to the standard stream or the file
+// configured for them, or along with the rest of logs unless one is.
+func newAccessLogger(config Config, output io.Writer) (*logrus.Logger, fileSink, error) {
+	access := logrus.New()
+	access.Formatter = &logrus.JSONFormatter{}
+	access.SetLevel(logrus.InfoLevel)
+
+	var file fileSink
+
+	switch destination := config.GetLoggerAccess(); destination {
+	case "":
+		access.SetOutput(output)
+	case ConsoleStdout, ConsoleStderr:
+		console, err := newConsoleSink(destination)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		access.SetOutput(console)
+	default:
+		var err error
+		file, err = newFileSink(destination, config.GetLoggerSize(), config.GetLoggerBackups(), config.GetLoggerAge())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		access.SetOutput(file)
+	}
+
+	return access, file, nil
+}
+
+// Reopen reopens log files, so that an external tool such as logrotate may move them away.
+func (l *Logger) Reopen() error {
+	for _, file := range []fileSink{l.file, l.accessFile} {
+		if file == nil {
+			continue
+		}
+
+		if err := file.Reopen(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes log files.
+func (l *Logger) Close() error {
+	for _, file := range []fileSink{l.file, l.accessFile} {
+		if file == nil {
+			continue
+		}
+
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (l *Logger) Trace(args ...interface{}) {
 	l.Logger.Trace(args...)
 }
@@ -81,3 +207,50 @@ func (l *Logger) Fatal(args ...interface{}) {
 func (l *Logger) Panic(args ...interface{}) {
 	l.Logger.Panic(args...)
 }
+
+// ContextWithRequestID returns the context of a request, log lines written with it carry the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request, which the context belongs to.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// entry returns an entry carrying fields of the context.
+func (l *Logger) entry(ctx context.Context) *logrus.Entry {
+	return contextEntry(l.Logger, ctx)
+}
+
+// contextEntry returns an entry of the logger carrying fields of the context.
+func contextEntry(logger *logrus.Logger, ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logger)
+	if id := RequestID(ctx); id != "" {
+		entry = entry.WithField(RequestIDField, id)
+	}
+
+	return entry
+}
+
+func (l *Logger) DebugContext(ctx context.Context, args ...interface{}) {
+	l.entry(ctx).Debug(args...)
+}
+
+func (l *Logger) InfoContext(ctx context.Context, args ...interface{}) {
+	l.entry(ctx).Info(args...)
+}
+
+func (l *Logger) WarnContext(ctx context.Context, args ...interface{}) {
+	l.entry(ctx).Warn(args...)
+}
+
+func (l *Logger) ErrorContext(ctx context.Context, args ...interface{}) {
+	l.entry(ctx).Error(args...)
+}
+
+// Access writes an access log line of the request. Access lines are always written, whatever the level is.
+func (l *Logger) Access(ctx context.Context, fields map[string]interface{}) {
+	contextEntry(l.access, ctx).WithFields(fields).Info("access")
+}
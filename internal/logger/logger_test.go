@@ -1,9 +1,14 @@
 package logger
 
 import (
+	"context"
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	internalconfig "github.com/spendmail/previewer/internal/config"
 	"github.com/stretchr/testify/require"
@@ -46,4 +51,210 @@ func TestLogger(t *testing.T) {
 		require.Contains(t, content, "warn_message", "Log doesn't contain string error")
 		require.Contains(t, content, "error_message", "Log doesn't contain string error")
 	})
+
+	t.Run("json with request id", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		f, err := os.CreateTemp("/tmp/", "")
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		config.Logger.Level = "info"
+		config.Logger.File = f.Name()
+		config.Logger.Format = FormatJSON
+
+		logger, err := New(config)
+		require.NoError(t, err)
+
+		ctx := ContextWithRequestID(context.Background(), "abc")
+		logger.WarnContext(ctx, "warn_message")
+		logger.Access(ctx, map[string]interface{}{"status": 200})
+		logger.Info("info_message")
+
+		b, err := ioutil.ReadFile(f.Name())
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		require.Len(t, lines, 3)
+
+		entries := make([]map[string]interface{}, 0, len(lines))
+		for _, line := range lines {
+			entry := make(map[string]interface{})
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+
+		require.Equal(t, "warn_message", entries[0]["msg"])
+		require.Equal(t, "abc", entries[0][RequestIDField])
+		require.Equal(t, "access", entries[1]["msg"])
+		require.Equal(t, "abc", entries[1][RequestIDField])
+		require.Equal(t, float64(200), entries[1]["status"])
+		require.NotContains(t, entries[2], RequestIDField)
+	})
+
+	t.Run("access", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		dir := t.TempDir()
+		config.Logger.Level = "error"
+		config.Logger.File = filepath.Join(dir, "previewer.log")
+		config.Logger.Format = FormatText
+		config.Logger.Access = filepath.Join(dir, "access.log")
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		ctx := ContextWithRequestID(context.Background(), "abc")
+		logger.Warn("warn_message")
+		logger.Access(ctx, map[string]interface{}{"status": 200})
+
+		// Access lines are JSON written to a file of their own whatever the level and the format are.
+		b, err := ioutil.ReadFile(config.Logger.Access)
+		require.NoError(t, err)
+
+		entry := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(b, &entry))
+		require.Equal(t, "access", entry["msg"])
+		require.Equal(t, "abc", entry[RequestIDField])
+		require.Equal(t, float64(200), entry["status"])
+
+		b, err = ioutil.ReadFile(config.Logger.File)
+		require.NoError(t, err)
+		require.Empty(t, b)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+		config.Logger.Format = "xml"
+
+		_, err = New(config)
+		require.ErrorIs(t, err, ErrLogFormat)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		dir := t.TempDir()
+		config.Logger.Level = "info"
+		config.Logger.File = filepath.Join(dir, "previewer.log")
+		config.Logger.Size = 1
+		config.Logger.Backups = 1
+
+		logger, err := New(config)
+		require.NoError(t, err)
+		defer logger.Close()
+
+		// Every line is about 10 KB, so that the file is rotated a couple of times.
+		message := strings.Repeat("x", 10*1024)
+		for i := 0; i < 250; i++ {
+			logger.Info(message)
+		}
+
+		require.Eventually(t, func() bool {
+			entries, err := os.ReadDir(dir)
+			return err == nil && len(entries) == 2
+		}, time.Second, 10*time.Millisecond, "only the file and a single backup must be kept")
+
+		info, err := os.Stat(config.Logger.File)
+		require.NoError(t, err)
+		require.LessOrEqual(t, info.Size(), int64(1024*1024))
+	})
+
+	t.Run("rotation by age", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "previewer.log")
+
+		// Size limit is disabled, so that the file is rotated by age only.
+		sink, err := newFileSink(path, 0, 5, 1)
+		require.NoError(t, err)
+		defer sink.Close()
+
+		now := time.Now()
+		file := sink.(*rotatingFile)
+		file.now = func() time.Time { return now }
+
+		_, err = sink.Write([]byte("first\n"))
+		require.NoError(t, err)
+
+		now = now.Add(23 * time.Hour)
+		_, err = sink.Write([]byte("second\n"))
+		require.NoError(t, err)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		now = now.Add(2 * time.Hour)
+		_, err = sink.Write([]byte("third\n"))
+		require.NoError(t, err)
+
+		entries, err = os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 2, "the file older than a day must be rotated")
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "third\n", string(b))
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		for _, size := range []int{0, 1} {
+			dir := t.TempDir()
+			config.Logger.File = filepath.Join(dir, "previewer.log")
+			config.Logger.Size = size
+
+			logger, err := New(config)
+			require.NoError(t, err)
+
+			logger.Info("before_rotation")
+
+			// External tool moves the file away and asks to reopen it.
+			moved := filepath.Join(dir, "previewer.log.1")
+			require.NoError(t, os.Rename(config.Logger.File, moved))
+			require.NoError(t, logger.Reopen())
+
+			logger.Info("after_rotation")
+			require.NoError(t, logger.Close())
+
+			b, err := ioutil.ReadFile(moved)
+			require.NoError(t, err)
+			require.Contains(t, string(b), "before_rotation")
+			require.NotContains(t, string(b), "after_rotation")
+
+			b, err = ioutil.ReadFile(config.Logger.File)
+			require.NoError(t, err)
+			require.Contains(t, string(b), "after_rotation")
+		}
+	})
+
+	t.Run("sinks", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		config.Logger.File = ""
+		config.Logger.Console = ConsoleStderr
+		logger, err := New(config)
+		require.NoError(t, err)
+		require.NoError(t, logger.Reopen())
+
+		config.Logger.Console = "syslog"
+		_, err = New(config)
+		require.ErrorIs(t, err, ErrLogSink)
+
+		config.Logger.Console = ""
+		_, err = New(config)
+		require.ErrorIs(t, err, ErrNoLogSinks)
+
+		config.Logger.File = "/very/wrong/path.log"
+		_, err = New(config)
+		require.ErrorIs(t, err, ErrLogFileOpen)
+	})
 }
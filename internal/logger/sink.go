@@ -0,0 +1,147 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	ConsoleStdout = "stdout"
+	ConsoleStderr = "stderr"
+
+	fileMode = 0o644
+
+	// unlimitedSize stands for no size limit of files rotated by age only, since zero size means
+	// the default limit to lumberjack.
+	unlimitedSize = math.MaxInt32
+)
+
+// fileSink is a log file, which may be reopened after it is moved away by an external tool.
+type fileSink interface {
+	io.WriteCloser
+	Reopen() error
+}
+
+// newFileSink returns a sink, which rotates the file once it grows beyond size megabytes or gets
+// older than age days, keeping at most backups rotated files not older than age days.
+// Zero size and age disable rotation by size and by age respectively.
+func newFileSink(path string, size, backups, age int) (fileSink, error) {
+	// The file is opened at once to report a wrong path on start.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrLogFileOpen, err)
+	}
+
+	if size <= 0 && age <= 0 {
+		return &plainFile{path: path, file: file}, nil
+	}
+
+	if size <= 0 {
+		size = unlimitedSize
+	}
+
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrLogFileOpen, err)
+	}
+
+	return &rotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    size,
+			MaxBackups: backups,
+			MaxAge:     age,
+		},
+		maxAge:  time.Duration(age) * 24 * time.Hour,
+		started: time.Now(),
+		now:     time.Now,
+	}, nil
+}
+
+// newConsoleSink returns the standard stream by name.
+func newConsoleSink(name string) (io.Writer, error) {
+	switch name {
+	case ConsoleStdout:
+		return os.Stdout, nil
+	case ConsoleStderr:
+		return os.Stderr, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrLogSink, name)
+	}
+}
+
+// plainFile is an append-only file.
+type plainFile struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+func (f *plainFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.file.Write(p)
+}
+
+// Reopen opens the file by its path again, writes go to the old file until it succeeds.
+func (f *plainFile) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLogFileOpen, err)
+	}
+
+	f.mutex.Lock()
+	old := f.file
+	f.file = file
+	f.mutex.Unlock()
+
+	return old.Close()
+}
+
+func (f *plainFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.file.Close()
+}
+
+// rotatingFile is a file rotated by size and age. Age of the file is counted since it was
+// opened or reopened by the service, or rotated by age, since file systems don't tell when it was created.
+type rotatingFile struct {
+	*lumberjack.Logger
+	mutex   sync.Mutex
+	maxAge  time.Duration
+	started time.Time
+	now     func() time.Time
+}
+
+// Write rotates the file first if it is too old, lumberjack rotates it by size itself.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.maxAge > 0 && f.now().Sub(f.started) >= f.maxAge {
+		if err := f.Logger.Rotate(); err != nil {
+			return 0, err
+		}
+
+		f.started = f.now()
+	}
+
+	return f.Logger.Write(p)
+}
+
+// Reopen closes the file, the next write opens it by its path again.
+func (f *rotatingFile) Reopen() error {
+	f.mutex.Lock()
+	f.started = f.now()
+	f.mutex.Unlock()
+
+	return f.Logger.Close()
+}
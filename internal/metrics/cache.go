@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cacheCollector reads cache counters on scrape, so that the cache doesn't depend on metrics.
+type cacheCollector struct {
+	cache     StatsSource
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+	items     *prometheus.Desc
+	bytes     *prometheus.Desc
+	// Level counters are labeled by level, they aren't summed into the ones of the cache as a whole.
+	levelHits   *prometheus.Desc
+	levelMisses *prometheus.Desc
+}
+
+func newCacheCollector(cache StatsSource) *cacheCollector {
+	return &cacheCollector{
+		cache:     cache,
+		hits:      prometheus.NewDesc(namespace+"_cache_hits_total", "Count of cache hits.", nil, nil),
+		misses:    prometheus.NewDesc(namespace+"_cache_misses_total", "Count of cache misses.", nil, nil),
+		evictions: prometheus.NewDesc(namespace+"_cache_evictions_total", "Count of items evicted to free space.", nil, nil),
+		items:     prometheus.NewDesc(namespace+"_cache_items", "Count of cached items.", nil, nil),
+		bytes:     prometheus.NewDesc(namespace+"_cache_bytes", "Total size of cached items.", nil, nil),
+		levelHits: prometheus.NewDesc(namespace+"_cache_level_hits_total",
+			"Count of hits of a level of the tiered cache.", []string{"level"}, nil),
+		levelMisses: prometheus.NewDesc(namespace+"_cache_level_misses_total",
+			"Count of misses of a level of the tiered cache.", []string{"level"}, nil),
+	}
+}
+
+// Describe sends descriptors of cache metrics.
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.items
+	ch <- c.bytes
+	ch <- c.levelHits
+	ch <- c.levelMisses
+}
+
+// Collect sends a snapshot of cache counters.
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.items, prometheus.GaugeValue, float64(stats.Items))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(stats.Bytes))
+
+	if source, ok := c.cache.(LevelStatsSource); ok {
+		levels := source.LevelStats()
+
+		ch <- prometheus.MustNewConstMetric(c.levelHits, prometheus.CounterValue, float64(levels.L1Hits), "l1")
+		ch <- prometheus.MustNewConstMetric(c.levelMisses, prometheus.CounterValue, float64(levels.L1Misses), "l1")
+		ch <- prometheus.MustNewConstMetric(c.levelHits, prometheus.CounterValue, float64(levels.L2Hits), "l2")
+		ch <- prometheus.MustNewConstMetric(c.levelMisses, prometheus.CounterValue, float64(levels.L2Misses), "l2")
+	}
+}
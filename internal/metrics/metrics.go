@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	internalcache "github.com/spendmail/previewer/internal/cache"
+)
+
+const (
+	namespace = "previewer"
+
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// StatsSource is implemented by caches, which count their hits, misses and evictions.
+type StatsSource interface {
+	Stats() internalcache.Stats
+}
+
+// LevelStatsSource is implemented by multi-level caches, which count hits and misses of each level.
+type LevelStatsSource interface {
+	LevelStats() internalcache.TieredStats
+}
+
+// Metrics holds collectors of the service, registered in a registry of its own.
+type Metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	downloadDuration *prometheus.HistogramVec
+	downloadSize     prometheus.Histogram
+	downloadInFlight prometheus.Gauge
+	resizeDuration   *prometheus.HistogramVec
+	resizeInFlight   prometheus.Gauge
+}
+
+// New is a metrics constructor: registers service collectors along with the Go runtime and process ones.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Count of handled HTTP requests.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of handled HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Count of HTTP requests being handled.",
+		}),
+		downloadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "download",
+			Name:      "duration_seconds",
+			Help:      "Duration of source image downloads.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"result"}),
+		downloadSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "download",
+			Name:      "size_bytes",
+			Help:      "Size of downloaded source images.",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+		}),
+		downloadInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "download",
+			Name:      "in_flight",
+			Help:      "Count of source image downloads in progress.",
+		}),
+		resizeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "resize",
+			Name:      "duration_seconds",
+			Help:      "Duration of image resizing.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"format", "mode"}),
+		resizeInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "resize",
+			Name:      "in_flight",
+			Help:      "Count of images being resized.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.downloadDuration,
+		m.downloadSize,
+		m.downloadInFlight,
+		m.resizeDuration,
+		m.resizeInFlight,
+	)
+
+	return m
+}
+
+// RegisterCache exposes counters of the cache, they are read on every scrape.
+// Counters of each level are exposed too, if the cache is a LevelStatsSource.
+func (m *Metrics) RegisterCache(cache StatsSource) {
+	m.registry.MustRegister(newCacheCollector(cache))
+}
+
+// Handler serves metrics in the text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RequestStarted counts a request in flight, the returned function observes it once handled.
+func (m *Metrics) RequestStarted() func(route, method string, status int) {
+	start := time.Now()
+	m.requestsInFlight.Inc()
+
+	return func(route, method string, status int) {
+		m.requestsInFlight.Dec()
+
+		labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	}
+}
+
+// DownloadStarted counts a download in flight, the returned function observes it once finished.
+func (m *Metrics) DownloadStarted() func(size int, err error) {
+	start := time.Now()
+	m.downloadInFlight.Inc()
+
+	return func(size int, err error) {
+		m.downloadInFlight.Dec()
+
+		if err != nil {
+			m.downloadDuration.WithLabelValues(ResultError).Observe(time.Since(start).Seconds())
+			return
+		}
+
+		m.downloadDuration.WithLabelValues(ResultOK).Observe(time.Since(start).Seconds())
+		m.downloadSize.Observe(float64(size))
+	}
+}
+
+// ResizeStarted counts a resize in flight, the returned function observes it once finished.
+func (m *Metrics) ResizeStarted(format, mode string) func() {
+	start := time.Now()
+	m.resizeInFlight.Inc()
+
+	return func() {
+		m.resizeInFlight.Dec()
+		m.resizeDuration.WithLabelValues(format, mode).Observe(time.Since(start).Seconds())
+	}
+}
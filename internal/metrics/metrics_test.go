@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	internalcache "github.com/spendmail/previewer/internal/cache"
+	"github.com/stretchr/testify/require"
+)
+
+// scrape returns metrics in the text exposition format.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("requests", func(t *testing.T) {
+		m := New()
+
+		done := m.RequestStarted()
+		require.Contains(t, scrape(t, m), "previewer_http_requests_in_flight 1")
+
+		done("/fill/{width}/{height}/{url}", http.MethodGet, http.StatusOK)
+		body := scrape(t, m)
+		require.Contains(t, body, "previewer_http_requests_in_flight 0")
+		require.Contains(t, body, `previewer_http_requests_total{method="GET",route="/fill/{width}/{height}/{url}",status="200"} 1`)
+		require.Contains(t, body, `previewer_http_request_duration_seconds_count{method="GET",route="/fill/{width}/{height}/{url}",status="200"} 1`)
+	})
+
+	t.Run("downloads", func(t *testing.T) {
+		m := New()
+
+		m.DownloadStarted()(2048, nil)
+		m.DownloadStarted()(0, errors.New("timeout"))
+
+		body := scrape(t, m)
+		require.Contains(t, body, `previewer_download_duration_seconds_count{result="ok"} 1`)
+		require.Contains(t, body, `previewer_download_duration_seconds_count{result="error"} 1`)
+		require.Contains(t, body, "previewer_download_size_bytes_sum 2048")
+		require.Contains(t, body, "previewer_download_in_flight 0")
+	})
+
+	t.Run("resizes", func(t *testing.T) {
+		m := New()
+
+		m.ResizeStarted("jpeg", "fill")()
+
+		body := scrape(t, m)
+		require.Contains(t, body, `previewer_resize_duration_seconds_count{format="jpeg",mode="fill"} 1`)
+		require.Contains(t, body, "previewer_resize_in_flight 0")
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		m := New()
+		cache := internalcache.NewMemoryCache(4)
+		m.RegisterCache(cache)
+
+		require.NoError(t, cache.Set("a", internalcache.NewItem([]byte("abc"))))
+		require.NoError(t, cache.Set("b", internalcache.NewItem([]byte("def"))))
+		_, _ = cache.Get("b")
+		_, _ = cache.Get("c")
+
+		body := scrape(t, m)
+		require.Contains(t, body, "previewer_cache_hits_total 1")
+		require.Contains(t, body, "previewer_cache_misses_total 1")
+		require.Contains(t, body, "previewer_cache_evictions_total 1")
+		require.Contains(t, body, "previewer_cache_items 1")
+		require.Contains(t, body, "previewer_cache_bytes 3")
+		require.NotContains(t, body, "previewer_cache_level_hits_total")
+	})
+
+	t.Run("tiered cache", func(t *testing.T) {
+		m := New()
+		l2 := internalcache.NewMemoryCache(4)
+		cache := internalcache.NewTieredCache(internalcache.NewMemoryCache(4), l2)
+		m.RegisterCache(cache)
+
+		require.NoError(t, l2.Set("a", internalcache.NewItem([]byte("abc"))))
+		_, _ = cache.Get("a")
+		_, _ = cache.Get("a")
+		_, _ = cache.Get("b")
+
+		body := scrape(t, m)
+		require.Contains(t, body, "previewer_cache_hits_total 2")
+		require.Contains(t, body, "previewer_cache_misses_total 1")
+		require.Contains(t, body, `previewer_cache_level_hits_total{level="l1"} 1`)
+		require.Contains(t, body, `previewer_cache_level_misses_total{level="l1"} 2`)
+		require.Contains(t, body, `previewer_cache_level_hits_total{level="l2"} 1`)
+		require.Contains(t, body, `previewer_cache_level_misses_total{level="l2"} 1`)
+	})
+}
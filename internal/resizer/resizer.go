@@ -1,6 +1,7 @@
 package resizer
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pkg/errors"
@@ -19,6 +20,7 @@ var (
 	ErrImageResize             = errors.New("unable to resize an image")
 	ErrQualitySetting          = errors.New("unable to set a compression quality")
 	ErrBothSizesNegativeOrZero = errors.New("both given sizes are negative or zero")
+	ErrResizerCheck            = errors.New("resizer is unavailable")
 )
 
 // Resize modifies file sizes by given slice of bytes.
@@ -60,3 +62,30 @@ func (r *Resizer) Resize(width, height uint, image []byte) ([]byte, error) {
 
 	return mw.GetImageBlob(), nil
 }
+
+// Check makes sure ImageMagick is initialized and able to encode images, rendering a blank one.
+func (r *Resizer) Check(ctx context.Context) error {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	if err := mw.SetSize(1, 1); err != nil {
+		return fmt.Errorf("%w: %s", ErrResizerCheck, err)
+	}
+
+	if err := mw.ReadImage("xc:white"); err != nil {
+		return fmt.Errorf("%w: %s", ErrResizerCheck, err)
+	}
+
+	if err := mw.SetImageFormat("jpeg"); err != nil {
+		return fmt.Errorf("%w: %s", ErrResizerCheck, err)
+	}
+
+	if len(mw.GetImageBlob()) == 0 {
+		return fmt.Errorf("%w: empty image", ErrResizerCheck)
+	}
+
+	return nil
+}
@@ -42,4 +42,8 @@ func TestResizer(t *testing.T) {
 		require.Equal(t, ImageWidth, img.Width, fmt.Sprintf("image width should be %d, but %d given", ImageWidth, img.Width))
 		require.Equal(t, ImageHeight, img.Height, fmt.Sprintf("image height should be %d, but %d given", ImageHeight, img.Height))
 	})
+
+	t.Run("check", func(t *testing.T) {
+		require.NoError(t, New().Check(context.Background()))
+	})
 }
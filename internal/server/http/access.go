@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internallogger "github.com/spendmail/previewer/internal/logger"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	// MaxRequestIDLength limits IDs taken from clients, longer ones are replaced with generated ones.
+	MaxRequestIDLength = 128
+)
+
+type accessKey struct{}
+
+// accessEntry collects details of serving a request, which only handlers know.
+type accessEntry struct {
+	cacheStatus  string
+	originStatus int
+}
+
+// accessLog writes a line per request, the request ID is taken from the X-Request-ID header
+// or generated, sent back to the client, forwarded to the origin and added to every log line
+// written while serving the request.
+func accessLog(logger Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(id) {
+			id = newRequestID()
+		}
+
+		entry := &accessEntry{}
+		ctx := internallogger.ContextWithRequestID(r.Context(), id)
+		ctx = context.WithValue(ctx, accessKey{}, entry)
+
+		r = r.Clone(ctx)
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		fields := map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      recorder.status,
+			"bytes":       recorder.bytes,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+		}
+
+		if entry.cacheStatus != "" {
+			fields["cache_status"] = entry.cacheStatus
+		}
+
+		if entry.originStatus != 0 {
+			fields["origin_status"] = entry.originStatus
+		}
+
+		logger.Access(ctx, fields)
+	})
+}
+
+// annotateAccess adds details of the result to the access log line of the request.
+func annotateAccess(r *http.Request, result *internalapp.Result) {
+	if entry, ok := r.Context().Value(accessKey{}).(*accessEntry); ok {
+		entry.cacheStatus = result.CacheStatus
+		entry.originStatus = result.OriginStatus
+	}
+}
+
+// isValidRequestID accepts non-empty IDs of printable ASCII characters, so that they are safe to log and forward.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
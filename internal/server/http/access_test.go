@@ -0,0 +1,116 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	internallogger "github.com/spendmail/previewer/internal/logger"
+	internalmetrics "github.com/spendmail/previewer/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	// newServer returns the handler of a server, which logs to a temporary file.
+	newServer := func(t *testing.T) (http.Handler, string) {
+		t.Helper()
+
+		config, err := internalconfig.NewConfig("../../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		f, err := os.CreateTemp("/tmp/", "")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.Remove(f.Name()) })
+
+		// Access lines are written whatever the level is.
+		config.Logger.Level = "error"
+		config.Logger.File = f.Name()
+		config.Logger.Format = internallogger.FormatJSON
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err)
+
+		return New(config, logger, fakeApplication{}, internalmetrics.New()).Server.Handler, f.Name()
+	}
+
+	// readLog returns log lines as JSON objects.
+	readLog := func(t *testing.T, path string) []map[string]interface{} {
+		t.Helper()
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+
+		entries := make([]map[string]interface{}, 0)
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			entry := make(map[string]interface{})
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+
+		return entries
+	}
+
+	t.Run("line per request", func(t *testing.T) {
+		handler, path := newServer(t)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fill/300/200/example.com/a.jpg", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		id := w.Header().Get(RequestIDHeader)
+		require.Len(t, id, 32)
+
+		entries := readLog(t, path)
+		require.Len(t, entries, 1)
+		require.Equal(t, "access", entries[0]["msg"])
+		require.Equal(t, id, entries[0][internallogger.RequestIDField])
+		require.Equal(t, http.MethodGet, entries[0]["method"])
+		require.Equal(t, "/fill/300/200/example.com/a.jpg", entries[0]["path"])
+		require.Equal(t, float64(http.StatusOK), entries[0]["status"])
+		require.Equal(t, float64(len("example.com/a.jpg")), entries[0]["bytes"])
+		require.Equal(t, "miss", entries[0]["cache_status"])
+		require.Equal(t, float64(http.StatusOK), entries[0]["origin_status"])
+		require.Contains(t, entries[0], "duration_ms")
+	})
+
+	t.Run("propagated request id", func(t *testing.T) {
+		handler, path := newServer(t)
+
+		r := httptest.NewRequest(http.MethodGet, "/fill/300/200/example.com/a.jpg", nil)
+		r.Header.Set(RequestIDHeader, "client-id")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, "client-id", w.Header().Get(RequestIDHeader))
+		require.Equal(t, "client-id", readLog(t, path)[0][internallogger.RequestIDField])
+
+		// Unsafe IDs are replaced.
+		r.Header.Set(RequestIDHeader, "bad id\n")
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Len(t, w.Header().Get(RequestIDHeader), 32)
+	})
+
+	t.Run("request id in error lines", func(t *testing.T) {
+		handler, path := newServer(t)
+
+		r := httptest.NewRequest(http.MethodGet, "/fill/300/200/example.com/broken.jpg", nil)
+		r.Header.Set(RequestIDHeader, "client-id")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusBadGateway, w.Code)
+
+		entries := readLog(t, path)
+		require.Len(t, entries, 2)
+		require.Equal(t, "error", entries[0]["level"])
+		require.Equal(t, "client-id", entries[0][internallogger.RequestIDField])
+		require.Equal(t, float64(http.StatusBadGateway), entries[1]["status"])
+		require.NotContains(t, entries[1], "cache_status")
+	})
+}
@@ -0,0 +1,365 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internalcache "github.com/spendmail/previewer/internal/cache"
+)
+
+const (
+	AdminPurgePattern       = "/cache"
+	AdminPurgeURLPattern    = "/cache/url"
+	AdminPurgePrefixPattern = "/cache/prefix"
+	AdminStatsPattern       = "/cache/stats"
+	AdminEntriesPattern     = "/cache/entries"
+	AdminVariantsPattern    = "/cache/variants"
+	AdminWarmupPattern      = "/cache/warmup"
+	URLParam                = "url"
+	PrefixParam             = "prefix"
+	OffsetParam             = "offset"
+	LimitParam              = "limit"
+	DefaultEntriesLimit     = 100
+	MaxEntriesLimit         = 1000
+	MaxWarmupItems          = 1000
+	MaxWarmupConcurrency    = 16
+)
+
+type AdminApplication interface {
+	PurgeAll()
+	PurgeURL(url string) (int, error)
+	Variants(url string) ([]string, error)
+	PurgePrefix(prefix string) (int, error)
+	CacheStats() (internalcache.Stats, error)
+	CacheEntries(prefix string, offset, limit int) ([]internalcache.Entry, int, error)
+	Warmup(ctx context.Context, items []internalapp.WarmupItem, concurrency int) []internalapp.WarmupResult
+}
+
+var (
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrParameterMissing    = errors.New("missing parameter")
+	ErrParameterParseRange = errors.New("unable to parse pagination parameter")
+	ErrWarmupRequest       = errors.New("invalid warmup request")
+)
+
+type AdminHandler struct {
+	App    AdminApplication
+	Logger Logger
+	Token  string
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+type variantsResponse struct {
+	Keys []string `json:"keys"`
+}
+
+type warmupItem struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type warmupRequest struct {
+	Items       []warmupItem `json:"items"`
+	Concurrency int          `json:"concurrency"`
+}
+
+type warmupResult struct {
+	warmupItem
+	OK    bool   `json:"ok"`
+	Bytes int    `json:"bytes,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type warmupResponse struct {
+	Rendered int            `json:"rendered"`
+	Failed   int            `json:"failed"`
+	Results  []warmupResult `json:"results"`
+}
+
+type statsResponse struct {
+	Items     int64   `json:"items"`
+	Bytes     int64   `json:"bytes"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	HitRatio  float64 `json:"hit_ratio"`
+}
+
+type entryResponse struct {
+	Key       string     `json:"key"`
+	Size      int64      `json:"size"`
+	Hash      string     `json:"hash"`
+	ModTime   time.Time  `json:"mod_time"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Source    string     `json:"source,omitempty"`
+}
+
+type entriesResponse struct {
+	Total   int             `json:"total"`
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	Entries []entryResponse `json:"entries"`
+}
+
+// NewAdmin is a cache management HTTP service constructor: it listens on its own address,
+// so that it can be kept away from public traffic.
+func NewAdmin(config Config, logger Logger, app AdminApplication) *Server {
+	handler := &AdminHandler{
+		App:    app,
+		Logger: logger,
+		Token:  config.GetAdminToken(),
+	}
+
+	router := mux.NewRouter()
+	router.Use(handler.authMiddleware)
+	router.HandleFunc(AdminPurgePattern, handler.purgeHandler).Methods(http.MethodDelete)
+	router.HandleFunc(AdminPurgeURLPattern, handler.purgeURLHandler).Methods(http.MethodDelete)
+	router.HandleFunc(AdminPurgePrefixPattern, handler.purgePrefixHandler).Methods(http.MethodDelete)
+	router.HandleFunc(AdminStatsPattern, handler.statsHandler).Methods(http.MethodGet)
+	router.HandleFunc(AdminEntriesPattern, handler.entriesHandler).Methods(http.MethodGet)
+	router.HandleFunc(AdminVariantsPattern, handler.variantsHandler).Methods(http.MethodGet)
+	router.HandleFunc(AdminWarmupPattern, handler.warmupHandler).Methods(http.MethodPost)
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort(config.GetAdminHost(), config.GetAdminPort()),
+		Handler: accessLog(logger, router),
+	}
+
+	return &Server{
+		Logger: logger,
+		Server: server,
+	}
+}
+
+// authMiddleware rejects requests without the bearer token, every request is rejected if the token is empty.
+func (h *AdminHandler) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A bare token, i.e. without the scheme, is rejected too.
+		header := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if h.Token == "" || token == header || subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) != 1 {
+			h.sendError(w, r, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// purgeHandler removes every cached variant.
+func (h *AdminHandler) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	h.App.PurgeAll()
+	h.Logger.InfoContext(r.Context(), "cache purged")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeURLHandler removes every cached variant of the source URL.
+func (h *AdminHandler) purgeURLHandler(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get(URLParam)
+	if url == "" {
+		h.sendError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrParameterMissing, URLParam))
+		return
+	}
+
+	purged, err := h.App.PurgeURL(url)
+	if err != nil {
+		h.sendAppError(w, r, err)
+		return
+	}
+
+	h.Logger.InfoContext(r.Context(), fmt.Sprintf("purged %d cached variants of %s", purged, url))
+	h.sendJSON(w, r, purgeResponse{purged})
+}
+
+// purgePrefixHandler removes cached variants, which source URLs start with the prefix.
+func (h *AdminHandler) purgePrefixHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get(PrefixParam)
+	if prefix == "" {
+		h.sendError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrParameterMissing, PrefixParam))
+		return
+	}
+
+	purged, err := h.App.PurgePrefix(prefix)
+	if err != nil {
+		h.sendAppError(w, r, err)
+		return
+	}
+
+	h.Logger.InfoContext(r.Context(), fmt.Sprintf("purged %d cached variants by prefix %s", purged, prefix))
+	h.sendJSON(w, r, purgeResponse{purged})
+}
+
+// statsHandler returns cache counters.
+func (h *AdminHandler) statsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.App.CacheStats()
+	if err != nil {
+		h.sendAppError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, r, statsResponse{stats.Items, stats.Bytes, stats.Hits, stats.Misses, stats.Evictions, stats.HitRatio()})
+}
+
+// entriesHandler returns a page of cached variants.
+func (h *AdminHandler) entriesHandler(w http.ResponseWriter, r *http.Request) {
+	offset, err := parseRangeParam(r, OffsetParam, 0)
+	if err != nil {
+		h.sendError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := parseRangeParam(r, LimitParam, DefaultEntriesLimit)
+	if err != nil {
+		h.sendError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if limit > MaxEntriesLimit {
+		limit = MaxEntriesLimit
+	}
+
+	entries, total, err := h.App.CacheEntries(r.URL.Query().Get(PrefixParam), offset, limit)
+	if err != nil {
+		h.sendAppError(w, r, err)
+		return
+	}
+
+	response := entriesResponse{total, offset, limit, make([]entryResponse, 0, len(entries))}
+	for _, entry := range entries {
+		e := entryResponse{entry.Key, entry.Size, entry.Hash, entry.ModTime, nil, entry.Source}
+		if !entry.ExpiresAt.IsZero() {
+			expiresAt := entry.ExpiresAt
+			e.ExpiresAt = &expiresAt
+		}
+
+		response.Entries = append(response.Entries, e)
+	}
+
+	h.sendJSON(w, r, response)
+}
+
+// variantsHandler returns cache keys of every cached variant of the source URL.
+func (h *AdminHandler) variantsHandler(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get(URLParam)
+	if url == "" {
+		h.sendError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrParameterMissing, URLParam))
+		return
+	}
+
+	keys, err := h.App.Variants(url)
+	if err != nil {
+		h.sendAppError(w, r, err)
+		return
+	}
+
+	h.sendJSON(w, r, variantsResponse{keys})
+}
+
+// warmupHandler renders a batch of variants ahead of requests, reporting the result of each of them.
+// Rendering stops if the client goes away.
+func (h *AdminHandler) warmupHandler(w http.ResponseWriter, r *http.Request) {
+	var request warmupRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrWarmupRequest, err))
+		return
+	}
+
+	if len(request.Items) == 0 || len(request.Items) > MaxWarmupItems {
+		h.sendError(w, r, http.StatusBadRequest, fmt.Errorf("%w: from 1 to %d items expected", ErrWarmupRequest, MaxWarmupItems))
+		return
+	}
+
+	items := make([]internalapp.WarmupItem, 0, len(request.Items))
+	for _, item := range request.Items {
+		if item.Width <= 0 || item.Height <= 0 || item.URL == "" {
+			h.sendError(w, r, http.StatusBadRequest, fmt.Errorf("%w: %+v", ErrWarmupRequest, item))
+			return
+		}
+
+		items = append(items, internalapp.WarmupItem{Width: item.Width, Height: item.Height, URL: item.URL})
+	}
+
+	if request.Concurrency > MaxWarmupConcurrency {
+		request.Concurrency = MaxWarmupConcurrency
+	}
+
+	response := warmupResponse{Results: make([]warmupResult, 0, len(items))}
+	for _, result := range h.App.Warmup(r.Context(), items, request.Concurrency) {
+		item := warmupResult{warmupItem: warmupItem{result.Item.Width, result.Item.Height, result.Item.URL}}
+
+		if result.Err != nil {
+			response.Failed++
+			item.Error = result.Err.Error()
+		} else {
+			response.Rendered++
+			item.OK = true
+			item.Bytes = result.Bytes
+		}
+
+		response.Results = append(response.Results, item)
+	}
+
+	h.Logger.InfoContext(r.Context(), fmt.Sprintf("warmup rendered %d of %d items", response.Rendered, len(items)))
+	h.sendJSON(w, r, response)
+}
+
+// parseRangeParam parses a non-negative query parameter, falling back to the default if it is missing.
+func parseRangeParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %s=%s", ErrParameterParseRange, name, value)
+	}
+
+	return n, nil
+}
+
+// sendAppError sends an application error, telling unsupported operations from failures.
+func (h *AdminHandler) sendAppError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, internalapp.ErrCacheAdmin) {
+		h.sendError(w, r, http.StatusNotImplemented, err)
+		return
+	}
+
+	h.sendError(w, r, http.StatusInternalServerError, err)
+}
+
+// sendError sends an error as a JSON object.
+func (h *AdminHandler) sendError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+		h.Logger.ErrorContext(r.Context(), fmt.Errorf("%w: %s", ErrResponseWrite, err.Error()))
+	}
+
+	if status >= http.StatusInternalServerError {
+		h.Logger.ErrorContext(r.Context(), err.Error())
+	}
+}
+
+// sendJSON sends a response as JSON.
+func (h *AdminHandler) sendJSON(w http.ResponseWriter, r *http.Request, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.Logger.ErrorContext(r.Context(), fmt.Errorf("%w: %s", ErrResponseWrite, err.Error()))
+	}
+}
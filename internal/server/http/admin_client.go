@@ -0,0 +1,128 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	internalapp "github.com/spendmail/previewer/internal/app"
+)
+
+var (
+	ErrAdminRequest = errors.New("admin request failed")
+	ErrWarmupItem   = errors.New("unable to render warmup item")
+)
+
+// AdminClient calls the cache management API of a running server.
+type AdminClient struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewAdminClient is an admin client constructor: the server is addressed by the admin listener of config.
+// Listeners on every interface are reached by the loopback one.
+func NewAdminClient(config Config) *AdminClient {
+	host := config.GetAdminHost()
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	return &AdminClient{
+		BaseURL: "http://" + net.JoinHostPort(host, config.GetAdminPort()),
+		Token:   config.GetAdminToken(),
+		Client:  &http.Client{},
+	}
+}
+
+// Warmup makes the server render the items into its cache, sending them in batches the server accepts.
+// Items, which fail to render, are reported by results, errors are returned if the server can't be called.
+func (c *AdminClient) Warmup(ctx context.Context, items []internalapp.WarmupItem, concurrency int) ([]internalapp.WarmupResult, error) {
+	results := make([]internalapp.WarmupResult, 0, len(items))
+
+	for start := 0; start < len(items); start += MaxWarmupItems {
+		end := start + MaxWarmupItems
+		if end > len(items) {
+			end = len(items)
+		}
+
+		batch, err := c.warmup(ctx, items[start:end], concurrency)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, batch...)
+	}
+
+	return results, nil
+}
+
+// warmup sends a single batch of items.
+func (c *AdminClient) warmup(ctx context.Context, items []internalapp.WarmupItem, concurrency int) ([]internalapp.WarmupResult, error) {
+	request := warmupRequest{Items: make([]warmupItem, 0, len(items)), Concurrency: concurrency}
+	for _, item := range items {
+		request.Items = append(request.Items, warmupItem{item.Width, item.Height, item.URL})
+	}
+
+	var response warmupResponse
+	if err := c.do(ctx, http.MethodPost, AdminWarmupPattern, request, &response); err != nil {
+		return nil, err
+	}
+
+	results := make([]internalapp.WarmupResult, 0, len(response.Results))
+	for _, item := range response.Results {
+		result := internalapp.WarmupResult{
+			Item:  internalapp.WarmupItem{Width: item.Width, Height: item.Height, URL: item.URL},
+			Bytes: item.Bytes,
+		}
+
+		if !item.OK {
+			result.Err = fmt.Errorf("%w: %s", ErrWarmupItem, item.Error)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// do sends the request as JSON, decoding the response into the given value.
+func (c *AdminClient) do(ctx context.Context, method, path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAdminRequest, err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAdminRequest, err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+c.Token)
+
+	w, err := c.Client.Do(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAdminRequest, err)
+	}
+	defer w.Body.Close()
+
+	if w.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(w.Body).Decode(&failure)
+
+		return fmt.Errorf("%w: %s: %s", ErrAdminRequest, w.Status, failure.Error)
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(response); err != nil {
+		return fmt.Errorf("%w: %s", ErrAdminRequest, err)
+	}
+
+	return nil
+}
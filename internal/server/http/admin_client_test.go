@@ -0,0 +1,61 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminClient(t *testing.T) {
+	t.Run("address", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../../configs/previewer.toml")
+		require.NoError(t, err)
+		config.Admin.Host, config.Admin.Port = "0.0.0.0", "8889"
+
+		require.Equal(t, "http://127.0.0.1:8889", NewAdminClient(config).BaseURL)
+
+		config.Admin.Host = "10.0.0.1"
+		require.Equal(t, "http://10.0.0.1:8889", NewAdminClient(config).BaseURL)
+	})
+
+	t.Run("warmup", func(t *testing.T) {
+		requests := 0
+		handler := newTestAdmin(t, &fakeAdminApplication{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			handler.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+
+		client := &AdminClient{BaseURL: server.URL, Token: testToken, Client: server.Client()}
+
+		// Items are sent in batches the server accepts.
+		items := make([]internalapp.WarmupItem, 0, MaxWarmupItems+1)
+		for i := 0; i < MaxWarmupItems; i++ {
+			items = append(items, internalapp.WarmupItem{Width: 300, Height: 200, URL: "example.com/" + strconv.Itoa(i) + ".jpg"})
+		}
+		items = append(items, internalapp.WarmupItem{Width: 300, Height: 200, URL: "example.com/a.txt"})
+
+		results, err := client.Warmup(context.Background(), items, 4)
+		require.NoError(t, err)
+		require.Equal(t, 2, requests)
+		require.Len(t, results, len(items))
+		require.Equal(t, internalapp.WarmupResult{Item: items[0], Bytes: 10}, results[0])
+
+		last := results[len(results)-1]
+		require.Equal(t, items[len(items)-1], last.Item)
+		require.Truef(t, errors.Is(last.Err, ErrWarmupItem), "actual error %q", last.Err)
+		require.Contains(t, last.Err.Error(), "not an image")
+
+		client.Token = "wrong"
+		_, err = client.Warmup(context.Background(), items[:1], 4)
+		require.Truef(t, errors.Is(err, ErrAdminRequest), "actual error %q", err)
+	})
+}
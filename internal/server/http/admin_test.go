@@ -0,0 +1,197 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internalcache "github.com/spendmail/previewer/internal/cache"
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	internallogger "github.com/spendmail/previewer/internal/logger"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "secret"
+
+// fakeAdminApplication records calls and answers with canned values.
+type fakeAdminApplication struct {
+	purgedAll   bool
+	purgedURL   string
+	unsupported bool
+	offset      int
+	limit       int
+	concurrency int
+}
+
+func (f *fakeAdminApplication) PurgeAll() {
+	f.purgedAll = true
+}
+
+func (f *fakeAdminApplication) PurgeURL(url string) (int, error) {
+	if f.unsupported {
+		return 0, internalapp.ErrCacheAdmin
+	}
+
+	f.purgedURL = url
+
+	return 2, nil
+}
+
+func (f *fakeAdminApplication) Variants(url string) ([]string, error) {
+	return []string{url + "-100-100", url + "-200-100"}, nil
+}
+
+func (f *fakeAdminApplication) PurgePrefix(prefix string) (int, error) {
+	return 3, nil
+}
+
+func (f *fakeAdminApplication) CacheStats() (internalcache.Stats, error) {
+	return internalcache.Stats{Items: 1, Bytes: 10, Hits: 3, Misses: 1}, nil
+}
+
+func (f *fakeAdminApplication) CacheEntries(prefix string, offset, limit int) ([]internalcache.Entry, int, error) {
+	f.offset, f.limit = offset, limit
+
+	return []internalcache.Entry{{Key: "example.com/a.jpg-100-100", Size: 10}}, 5, nil
+}
+
+func (f *fakeAdminApplication) Warmup(ctx context.Context, items []internalapp.WarmupItem, concurrency int) []internalapp.WarmupResult {
+	f.concurrency = concurrency
+
+	results := make([]internalapp.WarmupResult, 0, len(items))
+	for _, item := range items {
+		result := internalapp.WarmupResult{Item: item, Bytes: 10}
+		if strings.HasSuffix(item.URL, ".txt") {
+			result = internalapp.WarmupResult{Item: item, Err: errors.New("not an image")}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func newTestAdmin(t *testing.T, app AdminApplication) http.Handler {
+	t.Helper()
+
+	config, err := internalconfig.NewConfig("../../../configs/previewer.toml")
+	require.NoError(t, err)
+	config.Admin.Token = testToken
+
+	logger, err := internallogger.New(config)
+	require.NoError(t, err)
+
+	return NewAdmin(config, logger, app).Server.Handler
+}
+
+func serveAdmin(handler http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	return serveAdminBody(handler, method, target, token, "")
+}
+
+func serveAdminBody(handler http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAdmin(t *testing.T) {
+	t.Run("authorization", func(t *testing.T) {
+		app := &fakeAdminApplication{}
+		handler := newTestAdmin(t, app)
+
+		require.Equal(t, http.StatusUnauthorized, serveAdmin(handler, http.MethodDelete, "/cache", "").Code)
+		require.Equal(t, http.StatusUnauthorized, serveAdmin(handler, http.MethodDelete, "/cache", "wrong").Code)
+
+		r := httptest.NewRequest(http.MethodDelete, "/cache", nil)
+		r.Header.Set("Authorization", testToken)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.False(t, app.purgedAll)
+
+		require.Equal(t, http.StatusNoContent, serveAdmin(handler, http.MethodDelete, "/cache", testToken).Code)
+		require.True(t, app.purgedAll)
+	})
+
+	t.Run("purge url", func(t *testing.T) {
+		app := &fakeAdminApplication{}
+		handler := newTestAdmin(t, app)
+
+		w := serveAdmin(handler, http.MethodDelete, "/cache/url?url=example.com%2Fa.jpg", testToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"purged": 2}`, w.Body.String())
+		require.Equal(t, "example.com/a.jpg", app.purgedURL)
+
+		w = serveAdmin(handler, http.MethodDelete, "/cache/url", testToken)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		app.unsupported = true
+		w = serveAdmin(handler, http.MethodDelete, "/cache/url?url=example.com%2Fa.jpg", testToken)
+		require.Equal(t, http.StatusNotImplemented, w.Code)
+	})
+
+	t.Run("variants", func(t *testing.T) {
+		w := serveAdmin(newTestAdmin(t, &fakeAdminApplication{}), http.MethodGet, "/cache/variants?url=example.com%2Fa.jpg", testToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"keys": ["example.com/a.jpg-100-100", "example.com/a.jpg-200-100"]}`, w.Body.String())
+	})
+
+	t.Run("warmup", func(t *testing.T) {
+		app := &fakeAdminApplication{}
+		handler := newTestAdmin(t, app)
+
+		body := `{"items": [{"width": 300, "height": 200, "url": "example.com/a.jpg"}, {"width": 300, "height": 200, "url": "example.com/a.txt"}], "concurrency": 100}`
+		w := serveAdminBody(handler, http.MethodPost, "/cache/warmup", testToken, body)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, MaxWarmupConcurrency, app.concurrency)
+		require.JSONEq(t, `{
+			"rendered": 1,
+			"failed": 1,
+			"results": [
+				{"width": 300, "height": 200, "url": "example.com/a.jpg", "ok": true, "bytes": 10},
+				{"width": 300, "height": 200, "url": "example.com/a.txt", "ok": false, "error": "not an image"}
+			]
+		}`, w.Body.String())
+
+		for _, body := range []string{``, `{"items": []}`, `{"items": [{"width": 0, "height": 200, "url": "example.com/a.jpg"}]}`} {
+			w = serveAdminBody(handler, http.MethodPost, "/cache/warmup", testToken, body)
+			require.Equalf(t, http.StatusBadRequest, w.Code, "body %q", body)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		w := serveAdmin(newTestAdmin(t, &fakeAdminApplication{}), http.MethodGet, "/cache/stats", testToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"items": 1, "bytes": 10, "hits": 3, "misses": 1, "evictions": 0, "hit_ratio": 0.75}`, w.Body.String())
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		app := &fakeAdminApplication{}
+		handler := newTestAdmin(t, app)
+
+		w := serveAdmin(handler, http.MethodGet, "/cache/entries?offset=2&limit=5000", testToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, 2, app.offset)
+		require.Equal(t, MaxEntriesLimit, app.limit)
+
+		var response entriesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Equal(t, 5, response.Total)
+		require.Len(t, response.Entries, 1)
+		require.Nil(t, response.Entries[0].ExpiresAt)
+
+		w = serveAdmin(handler, http.MethodGet, "/cache/entries?offset=-1", testToken)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+)
+
+const (
+	CacheHeader            = "X-Cache"
+	ServerTimingHeader     = "Server-Timing"
+	SourceDimensionsHeader = "X-Source-Dimensions"
+	CacheHeaderHit         = "HIT"
+	CacheHeaderMiss        = "MISS"
+	CacheHeaderStale       = "STALE"
+)
+
+// setDebugHeaders tells how the result was served: whether it came from cache, how long each phase took
+// and, if known, dimensions of the source image.
+func setDebugHeaders(w http.ResponseWriter, result *internalapp.Result) {
+	switch result.CacheStatus {
+	case internalapp.CacheHit:
+		w.Header().Set(CacheHeader, CacheHeaderHit)
+	case internalapp.CacheStale, internalapp.CacheStaleIfError:
+		w.Header().Set(CacheHeader, CacheHeaderStale)
+	case internalapp.CacheMiss:
+		w.Header().Set(CacheHeader, CacheHeaderMiss)
+	}
+
+	if timing := serverTiming(result.Timings); timing != "" {
+		w.Header().Set(ServerTimingHeader, timing)
+	}
+
+	if result.SourceWidth > 0 && result.SourceHeight > 0 {
+		w.Header().Set(SourceDimensionsHeader, fmt.Sprintf("%dx%d", result.SourceWidth, result.SourceHeight))
+	}
+}
+
+// serverTiming formats timings of phases, which happened, e.g. "cache;dur=0.3, fetch;dur=120.5".
+func serverTiming(timings internalapp.Timings) string {
+	metrics := make([]string, 0, 3)
+
+	for _, phase := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"cache", timings.Cache},
+		{"fetch", timings.Fetch},
+		{"resize", timings.Resize},
+	} {
+		if phase.duration > 0 {
+			// Durations are in milliseconds.
+			metrics = append(metrics, fmt.Sprintf("%s;dur=%.1f", phase.name, phase.duration.Seconds()*1000))
+		}
+	}
+
+	return strings.Join(metrics, ", ")
+}
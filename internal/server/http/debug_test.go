@@ -0,0 +1,82 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	internallogger "github.com/spendmail/previewer/internal/logger"
+	internalmetrics "github.com/spendmail/previewer/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	t.Run("response headers", func(t *testing.T) {
+		config, err := internalconfig.NewConfig("../../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err)
+
+		handler := New(config, logger, fakeApplication{}, internalmetrics.New()).Server.Handler
+
+		w := serveAdmin(handler, http.MethodGet, "/fill/300/200/example.com/a.jpg", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+		require.Equal(t, CacheHeaderMiss, w.Header().Get(CacheHeader))
+		require.Equal(t, "cache;dur=1.0, fetch;dur=120.0, resize;dur=30.0", w.Header().Get(ServerTimingHeader))
+		require.Equal(t, "2000x1000", w.Header().Get(SourceDimensionsHeader))
+		require.Equal(t, "17", w.Header().Get("Content-Length"))
+		require.Equal(t, "example.com/a.jpg", w.Body.String())
+
+		r := httptest.NewRequest(http.MethodGet, "/fill/300/200/example.com/a.jpg", nil)
+		r.Header.Set("Range", "bytes=0-6")
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusPartialContent, w.Code)
+		require.Equal(t, "bytes 0-6/17", w.Header().Get("Content-Range"))
+		require.Equal(t, "example", w.Body.String())
+
+		r = httptest.NewRequest(http.MethodGet, "/fill/300/200/example.com/a.jpg", nil)
+		r.Header.Set("If-None-Match", `"etag"`)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotModified, w.Code)
+		require.Empty(t, w.Body.String())
+	})
+
+	t.Run("cache control", func(t *testing.T) {
+		now := time.Now()
+
+		require.Equal(t, "public, max-age=60", cacheControl(internalapp.CachePolicy{}, 60, now))
+		require.Equal(t, "public, max-age=60", cacheControl(internalapp.CachePolicy{FreshUntil: now.Add(time.Hour)}, 60, now))
+		require.Equal(t, "public, max-age=30", cacheControl(internalapp.CachePolicy{FreshUntil: now.Add(30 * time.Second)}, 60, now))
+		require.Equal(t, "public, max-age=0", cacheControl(internalapp.CachePolicy{FreshUntil: now.Add(-time.Second)}, 60, now))
+		require.Equal(t, "no-store", cacheControl(internalapp.CachePolicy{NoStore: true}, 60, now))
+	})
+
+	t.Run("cache status", func(t *testing.T) {
+		for status, header := range map[string]string{
+			internalapp.CacheHit:          CacheHeaderHit,
+			internalapp.CacheMiss:         CacheHeaderMiss,
+			internalapp.CacheStale:        CacheHeaderStale,
+			internalapp.CacheStaleIfError: CacheHeaderStale,
+		} {
+			w := httptest.NewRecorder()
+			setDebugHeaders(w, &internalapp.Result{CacheStatus: status})
+			require.Equal(t, header, w.Header().Get(CacheHeader))
+
+			// Phases, which didn't happen, and unknown dimensions are omitted.
+			require.Empty(t, w.Header().Get(ServerTimingHeader))
+			require.Empty(t, w.Header().Get(SourceDimensionsHeader))
+		}
+	})
+
+	t.Run("server timing", func(t *testing.T) {
+		require.Equal(t, "cache;dur=0.3", serverTiming(internalapp.Timings{Cache: 300 * time.Microsecond}))
+		require.Equal(t, "fetch;dur=1500.0", serverTiming(internalapp.Timings{Fetch: 1500 * time.Millisecond}))
+	})
+}
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	HealthzPattern = "/healthz"
+	ReadyzPattern  = "/readyz"
+
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// healthzHandler tells the process is up.
+func (h *Handler) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	h.sendHealth(w, r, http.StatusOK, readinessResponse{Status: StatusOK})
+}
+
+// readyzHandler tells whether previews can be served, it fails once the server is draining.
+func (h *Handler) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.draining) == 1 {
+		h.sendHealth(w, r, http.StatusServiceUnavailable, readinessResponse{Status: StatusDraining})
+		return
+	}
+
+	status := http.StatusOK
+	response := readinessResponse{StatusOK, make(map[string]string)}
+
+	for _, check := range h.App.Readiness(r.Context()) {
+		if check.Err != nil {
+			status = http.StatusServiceUnavailable
+			response.Status = StatusUnavailable
+			response.Checks[check.Name] = check.Err.Error()
+			h.Logger.ErrorContext(r.Context(), check.Err.Error())
+
+			continue
+		}
+
+		response.Checks[check.Name] = StatusOK
+	}
+
+	h.sendHealth(w, r, status, response)
+}
+
+// sendHealth sends a probe response as JSON, probe responses are never cached.
+func (h *Handler) sendHealth(w http.ResponseWriter, r *http.Request, status int, response readinessResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.Logger.ErrorContext(r.Context(), err.Error())
+	}
+}
+
+// Drain makes readiness checks fail, so that load balancers stop sending requests before the server stops.
+func (s *Server) Drain() {
+	if s.handler != nil {
+		atomic.StoreInt32(&s.handler.draining, 1)
+	}
+}
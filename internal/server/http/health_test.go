@@ -0,0 +1,72 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	internallogger "github.com/spendmail/previewer/internal/logger"
+	internalmetrics "github.com/spendmail/previewer/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	newServer := func(t *testing.T, app Application) *Server {
+		t.Helper()
+
+		config, err := internalconfig.NewConfig("../../../configs/previewer.toml")
+		require.NoError(t, err)
+
+		logger, err := internallogger.New(config)
+		require.NoError(t, err)
+
+		return New(config, logger, app, internalmetrics.New())
+	}
+
+	t.Run("liveness", func(t *testing.T) {
+		server := newServer(t, fakeApplication{checks: []internalapp.Check{{Name: internalapp.CheckCache, Err: errors.New("disk full")}}})
+
+		// Liveness doesn't depend on dependencies.
+		w := serveAdmin(server.Server.Handler, http.MethodGet, HealthzPattern, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		server := newServer(t, fakeApplication{checks: []internalapp.Check{{Name: internalapp.CheckCache}, {Name: internalapp.CheckResizer}}})
+
+		w := serveAdmin(server.Server.Handler, http.MethodGet, ReadyzPattern, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"status": "ok", "checks": {"cache": "ok", "resizer": "ok"}}`, w.Body.String())
+		require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		server := newServer(t, fakeApplication{checks: []internalapp.Check{
+			{Name: internalapp.CheckCache},
+			{Name: internalapp.CheckOrigin, Err: internalapp.ErrOriginCheck},
+		}})
+
+		w := serveAdmin(server.Server.Handler, http.MethodGet, ReadyzPattern, "")
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		require.JSONEq(t, `{"status": "unavailable", "checks": {"cache": "ok", "origin": "origin is unavailable"}}`, w.Body.String())
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		server := newServer(t, fakeApplication{})
+
+		require.Equal(t, http.StatusOK, serveAdmin(server.Server.Handler, http.MethodGet, ReadyzPattern, "").Code)
+
+		server.Drain()
+
+		w := serveAdmin(server.Server.Handler, http.MethodGet, ReadyzPattern, "")
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		require.JSONEq(t, `{"status": "draining"}`, w.Body.String())
+
+		// Previews are still served until the server stops.
+		require.Equal(t, http.StatusOK, serveAdmin(server.Server.Handler, http.MethodGet, "/fill/300/200/example.com/a.jpg", "").Code)
+		require.Equal(t, http.StatusOK, serveAdmin(server.Server.Handler, http.MethodGet, HealthzPattern, "").Code)
+	})
+}
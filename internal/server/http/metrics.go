@@ -0,0 +1,100 @@
+package http
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MetricsPattern = "/metrics"
+	// UnmatchedRoute labels requests, which match no route, keeping label values bounded.
+	UnmatchedRoute = "unmatched"
+)
+
+type Metrics interface {
+	RequestStarted() func(route, method string, status int)
+	Handler() http.Handler
+}
+
+// statusRecorder remembers the status code and the count of bytes written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
+
+// ReadFrom keeps the underlying writer able to stream files by sendfile.
+func (r *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	var (
+		n   int64
+		err error
+	)
+
+	if readerFrom, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{r.ResponseWriter}, src)
+	}
+
+	r.bytes += int(n)
+
+	return n, err
+}
+
+// Unwrap returns the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// writerOnly hides methods of the writer other than Write, so that io.Copy doesn't call ReadFrom back.
+type writerOnly struct {
+	io.Writer
+}
+
+// instrument wraps the router, so that requests are observed by route template and status code.
+func instrument(router *mux.Router, metrics Metrics) {
+	router.Use(func(next http.Handler) http.Handler {
+		return observe(next, metrics, func(r *http.Request) string {
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					return template
+				}
+			}
+
+			return UnmatchedRoute
+		})
+	})
+
+	// Middlewares aren't applied to requests, which match no route.
+	unmatched := func(*http.Request) string { return UnmatchedRoute }
+	router.NotFoundHandler = observe(http.NotFoundHandler(), metrics, unmatched)
+	router.MethodNotAllowedHandler = observe(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}), metrics, unmatched)
+}
+
+// observe counts the request in flight and observes its latency once handled.
+func observe(next http.Handler, metrics Metrics, route func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := metrics.RequestStarted()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		done(route(r), r.Method, recorder.status)
+	})
+}
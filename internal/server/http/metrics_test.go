@@ -0,0 +1,111 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	internalapp "github.com/spendmail/previewer/internal/app"
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	internallogger "github.com/spendmail/previewer/internal/logger"
+	internalmetrics "github.com/spendmail/previewer/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeApplication answers with the requested URL as an image, URLs of broken images fail.
+type fakeApplication struct {
+	checks []internalapp.Check
+}
+
+func (f fakeApplication) Readiness(ctx context.Context) []internalapp.Check {
+	return f.checks
+}
+
+func (fakeApplication) ResizeImageByURL(ctx context.Context, width, height int, url string, headers map[string][]string) (*internalapp.Result, error) {
+	if strings.Contains(url, "broken") {
+		return nil, internalapp.ErrFileNotFound
+	}
+
+	return &internalapp.Result{
+		Body:         strings.NewReader(url),
+		Size:         int64(len(url)),
+		ContentType:  "image/jpeg",
+		Width:        width,
+		Height:       height,
+		ETag:         "etag",
+		LastModified: time.Now(),
+		CacheStatus:  internalapp.CacheMiss,
+		OriginStatus: http.StatusOK,
+		Timings:      internalapp.Timings{Cache: time.Millisecond, Fetch: 120 * time.Millisecond, Resize: 30 * time.Millisecond},
+		SourceWidth:  2000,
+		SourceHeight: 1000,
+	}, nil
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	config, err := internalconfig.NewConfig("../../../configs/previewer.toml")
+	require.NoError(t, err)
+
+	logger, err := internallogger.New(config)
+	require.NoError(t, err)
+
+	handler := New(config, logger, fakeApplication{}, internalmetrics.New()).Server.Handler
+
+	require.Equal(t, http.StatusOK, serveAdmin(handler, http.MethodGet, "/fill/300/200/example.com/a.jpg", "").Code)
+	require.Equal(t, http.StatusNotFound, serveAdmin(handler, http.MethodGet, "/crop/300/200/example.com/a.jpg", "").Code)
+	require.Equal(t, http.StatusMethodNotAllowed, serveAdmin(handler, http.MethodPost, "/fill/300/200/example.com/a.jpg", "").Code)
+
+	w := serveAdmin(handler, http.MethodGet, MetricsPattern, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	require.Contains(t, body, `previewer_http_requests_total{method="GET",route="`+URLResizePattern+`",status="200"} 1`)
+	require.Contains(t, body, `previewer_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	require.Contains(t, body, `previewer_http_requests_total{method="POST",route="unmatched",status="405"} 1`)
+	require.Contains(t, body, "previewer_http_requests_in_flight 1")
+}
+
+// readerFromRecorder counts bytes streamed through ReadFrom.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	streamed int64
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	n, err := io.Copy(r.ResponseRecorder, src)
+	r.streamed += n
+
+	return n, err
+}
+
+func TestStatusRecorder(t *testing.T) {
+	t.Run("reader from", func(t *testing.T) {
+		w := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		// Streaming, as http.ServeContent does it, reaches the underlying writer, so that it may use sendfile.
+		n, err := io.CopyN(recorder, strings.NewReader("aaa"), 3)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+		require.Equal(t, int64(3), w.streamed)
+		require.Equal(t, 3, recorder.bytes)
+		require.Equal(t, "aaa", w.Body.String())
+	})
+
+	t.Run("plain writer", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		n, err := recorder.ReadFrom(bytes.NewReader([]byte("aaa")))
+		require.NoError(t, err)
+		require.Equal(t, int64(3), n)
+		require.Equal(t, 3, recorder.bytes)
+		require.Equal(t, "aaa", w.Body.String())
+		require.Equal(t, http.ResponseWriter(w), recorder.Unwrap())
+	})
+}
@@ -6,9 +6,11 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	internalapp "github.com/spendmail/previewer/internal/app"
 )
 
 const (
@@ -21,6 +23,10 @@ const (
 type Config interface {
 	GetHTTPHost() string
 	GetHTTPPort() string
+	GetHTTPMaxAge() int
+	GetAdminHost() string
+	GetAdminPort() string
+	GetAdminToken() string
 }
 
 type Logger interface {
@@ -28,15 +34,21 @@ type Logger interface {
 	Info(args ...interface{})
 	Warn(args ...interface{})
 	Error(args ...interface{})
+	InfoContext(ctx context.Context, args ...interface{})
+	ErrorContext(ctx context.Context, args ...interface{})
+	Access(ctx context.Context, fields map[string]interface{})
 }
 
 type Application interface {
-	ResizeImageByURL(width, height int, url string, headers map[string][]string) ([]byte, error)
+	ResizeImageByURL(ctx context.Context, width, height int, url string, headers map[string][]string) (*internalapp.Result, error)
+	Readiness(ctx context.Context) []internalapp.Check
 }
 
 type Server struct {
 	Logger Logger
 	Server *http.Server
+	// handler is nil for servers, which don't serve probes.
+	handler *Handler
 }
 
 var (
@@ -49,26 +61,35 @@ var (
 type Handler struct {
 	App    Application
 	Logger Logger
+	MaxAge int
+	// draining is set once the server is about to stop.
+	draining int32
 }
 
 // New is HTTP service constructor.
-func New(config Config, logger Logger, app Application) *Server {
+func New(config Config, logger Logger, app Application, metrics Metrics) *Server {
 	handler := &Handler{
 		App:    app,
 		Logger: logger,
+		MaxAge: config.GetHTTPMaxAge(),
 	}
 
 	router := mux.NewRouter()
-	router.HandleFunc(URLResizePattern, handler.resizeHandler).Methods(http.MethodGet)
+	instrument(router, metrics)
+	router.HandleFunc(URLResizePattern, traced("http.resizeHandler", handler.resizeHandler)).Methods(http.MethodGet)
+	router.Handle(MetricsPattern, metrics.Handler()).Methods(http.MethodGet)
+	router.HandleFunc(HealthzPattern, handler.healthzHandler).Methods(http.MethodGet)
+	router.HandleFunc(ReadyzPattern, handler.readyzHandler).Methods(http.MethodGet)
 
 	server := &http.Server{
 		Addr:    net.JoinHostPort(config.GetHTTPHost(), config.GetHTTPPort()),
-		Handler: router,
+		Handler: accessLog(logger, router),
 	}
 
 	return &Server{
-		Logger: logger,
-		Server: server,
+		Logger:  logger,
+		Server:  server,
+		handler: handler,
 	}
 }
 
@@ -76,36 +97,62 @@ func New(config Config, logger Logger, app Application) *Server {
 func (h *Handler) resizeHandler(w http.ResponseWriter, r *http.Request) {
 	width, err := strconv.Atoi(mux.Vars(r)[WidthField])
 	if err != nil {
-		SendBadGatewayStatus(w, h, fmt.Errorf("%w: %s", ErrParameterParseWidth, err))
+		SendBadGatewayStatus(w, r, h, fmt.Errorf("%w: %s", ErrParameterParseWidth, err))
 		return
 	}
 
 	height, err := strconv.Atoi(mux.Vars(r)[HeightField])
 	if err != nil {
-		SendBadGatewayStatus(w, h, fmt.Errorf("%w: %s", ErrParameterParseHeight, err))
+		SendBadGatewayStatus(w, r, h, fmt.Errorf("%w: %s", ErrParameterParseHeight, err))
 		return
 	}
 
-	bytes, err := h.App.ResizeImageByURL(width, height, mux.Vars(r)[URLField], r.Header)
+	// Conditional and range headers, which refer to our own responses, are not forwarded to the origin.
+	result, err := h.App.ResizeImageByURL(r.Context(), width, height, mux.Vars(r)[URLField], r.Header)
 	if err != nil {
-		SendBadGatewayStatus(w, h, err)
+		SendBadGatewayStatus(w, r, h, err)
 		return
 	}
+	defer result.Close()
+
+	annotateAccess(r, result)
+	setDebugHeaders(w, result)
+
+	w.Header().Set("ETag", fmt.Sprintf("%q", result.ETag))
+	w.Header().Set("Cache-Control", cacheControl(result.CachePolicy, h.MaxAge, time.Now()))
+	w.Header().Set("Content-Type", result.ContentType)
+
+	// The image is streamed, ServeContent answers conditional and range requests by the headers above.
+	http.ServeContent(w, r, "", result.LastModified, result.Body)
+}
 
-	w.Header().Set("Content-Type", http.DetectContentType(bytes))
-	w.Header().Set("Content-Length", strconv.Itoa(len(bytes)))
-	if _, err := w.Write(bytes); err != nil {
-		h.Logger.Error(fmt.Errorf("%w: %s", ErrResizeImage, err.Error()))
+// cacheControl allows clients to cache the image for max age seconds at most, as long as it is fresh,
+// unless the origin forbids caching it.
+func cacheControl(policy internalapp.CachePolicy, maxAge int, now time.Time) string {
+	if policy.NoStore {
+		return "no-store"
 	}
+
+	if !policy.FreshUntil.IsZero() {
+		if fresh := int(policy.FreshUntil.Sub(now) / time.Second); fresh < maxAge {
+			maxAge = fresh
+		}
+
+		if maxAge < 0 {
+			maxAge = 0
+		}
+	}
+
+	return fmt.Sprintf("public, max-age=%d", maxAge)
 }
 
 // SendBadGatewayStatus sends http.StatusBadGateway response with custom message.
-func SendBadGatewayStatus(w http.ResponseWriter, h *Handler, err error) {
+func SendBadGatewayStatus(w http.ResponseWriter, r *http.Request, h *Handler, err error) {
 	w.WriteHeader(http.StatusBadGateway)
 	if n, e := w.Write([]byte(err.Error())); e != nil {
-		h.Logger.Error(fmt.Errorf("%w: trying to write %d bytes: %s", ErrResponseWrite, n, e.Error()))
+		h.Logger.ErrorContext(r.Context(), fmt.Errorf("%w: trying to write %d bytes: %s", ErrResponseWrite, n, e.Error()))
 	}
-	h.Logger.Error(err.Error())
+	h.Logger.ErrorContext(r.Context(), err.Error())
 }
 
 // Start launches a HTTP server.
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+const (
+	ServiceName = "previewer"
+
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+var (
+	ErrUnknownExporter = errors.New("unknown tracing exporter")
+	ErrExporterCreate  = errors.New("unable to create tracing exporter")
+)
+
+type Config interface {
+	GetTracingExporter() string
+	GetTracingEndpoint() string
+	GetTracingInsecure() bool
+	GetTracingSampleRatio() float64
+}
+
+// Tracing owns the tracer provider installed globally, so that spans are flushed on shutdown.
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+}
+
+// New is a tracing constructor: it installs the W3C trace context propagator and, unless
+// the exporter is "none", a tracer provider exporting spans.
+func New(config Config) (*Tracing, error) {
+	// Incoming trace context is honored and propagated even if spans aren't exported.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch config.GetTracingExporter() {
+	case ExporterNone, "":
+		return &Tracing{}, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.GetTracingEndpoint())}
+		if config.GetTracingInsecure() {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownExporter, config.GetTracingExporter())
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrExporterCreate, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceNameKey.String(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrExporterCreate, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.GetTracingSampleRatio()))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return &Tracing{provider: provider}, nil
+}
+
+// Shutdown flushes pending spans.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+
+	return t.provider.Shutdown(ctx)
+}
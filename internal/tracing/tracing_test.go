@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	internalconfig "github.com/spendmail/previewer/internal/config"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	newConfig := func(t *testing.T, exporter string) *internalconfig.Config {
+		t.Helper()
+
+		config, err := internalconfig.NewConfig("../../configs/previewer.toml")
+		require.NoError(t, err)
+		config.Tracing.Exporter = exporter
+
+		return config
+	}
+
+	t.Run("none", func(t *testing.T) {
+		tracing, err := New(newConfig(t, ExporterNone))
+		require.NoError(t, err)
+		require.Contains(t, otel.GetTextMapPropagator().Fields(), "traceparent")
+		require.NoError(t, tracing.Shutdown(context.Background()))
+	})
+
+	t.Run("stdout", func(t *testing.T) {
+		defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+		tracing, err := New(newConfig(t, ExporterStdout))
+		require.NoError(t, err)
+
+		_, span := otel.Tracer("test").Start(context.Background(), "span")
+		require.True(t, span.SpanContext().IsSampled())
+		span.End()
+
+		require.NoError(t, tracing.Shutdown(context.Background()))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := New(newConfig(t, "jaeger"))
+		require.ErrorIs(t, err, ErrUnknownExporter)
+	})
+}
@@ -67,6 +67,39 @@ func TestHTTP(t *testing.T) {
 		require.Equal(t, ImageHeight, img.Height, fmt.Sprintf("image height should be %d, but %d given", ImageHeight, img.Height))
 	})
 
+	t.Run("http status 304", func(t *testing.T) {
+		u, err := url.Parse(HTTPHost)
+		require.NoError(t, err, "should be without errors")
+
+		u.Path = path.Join(u.Path, HTTPHostPath, ImageURL)
+		testingURL := u.String()
+
+		t.Logf("Requesting %v\n", testingURL)
+		request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, testingURL, nil)
+		require.NoError(t, err, "should be without errors")
+
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err, "should be without errors")
+		defer response.Body.Close()
+
+		require.Equal(t, response.StatusCode, http.StatusOK, fmt.Sprintf("response status code should be %d, but %d given", http.StatusOK, response.StatusCode))
+		etag := response.Header.Get("ETag")
+		require.NotEmpty(t, etag, "etag should be set")
+		require.NotEmpty(t, response.Header.Get("Last-Modified"), "last-modified should be set")
+		require.True(t, strings.HasPrefix(response.Header.Get("Cache-Control"), "public, max-age="), "cache-control should be public")
+
+		request, err = http.NewRequestWithContext(context.Background(), http.MethodGet, testingURL, nil)
+		require.NoError(t, err, "should be without errors")
+		request.Header.Set("If-None-Match", etag)
+
+		conditionalResponse, err := http.DefaultClient.Do(request)
+		require.NoError(t, err, "should be without errors")
+		defer conditionalResponse.Body.Close()
+
+		require.Equal(t, conditionalResponse.StatusCode, http.StatusNotModified, fmt.Sprintf("response status code should be %d, but %d given", http.StatusNotModified, conditionalResponse.StatusCode))
+		require.Equal(t, etag, conditionalResponse.Header.Get("ETag"), "etag should be the same")
+	})
+
 	t.Run("wrong image url", func(t *testing.T) {
 		u, err := url.Parse(HTTPHost)
 		require.NoError(t, err, "should be without errors")